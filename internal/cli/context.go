@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"flag"
 	"strings"
 
 	"github.com/tommed/ducto-featureflags/sdk"
@@ -26,3 +27,28 @@ func parseContext(flags []string) sdk.EvalContext {
 	}
 	return ctx
 }
+
+// loadFlags are the command line flags shared by every command which loads a flag file
+type loadFlags struct {
+	env          string
+	strict       bool
+	strictFields bool
+}
+
+func (l *loadFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&l.env, "env", "", "Environment whose flag overrides should be applied")
+	fs.BoolVar(&l.strict, "strict", false, "Refuse to load flag files which fail validation")
+	fs.BoolVar(&l.strictFields, "strict-fields", false, "Refuse to load flag files containing unknown fields")
+}
+
+// options converts the flags into sdk options
+func (l *loadFlags) options() []sdk.Option {
+	opts := []sdk.Option{sdk.WithEnvironment(l.env)}
+	if l.strict {
+		opts = append(opts, sdk.WithStrictValidation())
+	}
+	if l.strictFields {
+		opts = append(opts, sdk.WithStrictDecoding())
+	}
+	return opts
+}
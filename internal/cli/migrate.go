@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tommed/ducto-featureflags/internal/fsutil"
+	"github.com/tommed/ducto-featureflags/sdk"
+)
+
+// Migrate rewrites a flag file of any version in place, as a current version envelope
+//
+//goland:noinspection GoUnhandledErrorResult
+func Migrate(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var file string
+	var dryRun bool
+	var force bool
+
+	fs.StringVar(&file, "file", "flags.json", "Path to feature flag definition file")
+	fs.BoolVar(&dryRun, "dry-run", false, "Print the migrated file instead of rewriting it")
+	fs.BoolVar(&force, "force", false, "Migrate even if unknown fields would be dropped")
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintf(stderr, "failed to parse migrate flags: %v\n", err)
+		return 1
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to read flags: %v\n", err)
+		return 1
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to read flags: %v\n", err)
+		return 1
+	}
+
+	// Fields which are not part of the format would be silently dropped, so they are errors here
+	format := sdk.DetectFormat(file)
+	diags, err := sdk.Validate(data, format, sdk.WithStrictDecoding())
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to migrate flags: %v\n", err)
+		return 1
+	}
+	errs := diags.Errors()
+	printDiagnostics(stderr, file, errs)
+	lost := false
+	for _, d := range errs {
+		lost = lost || d.Code == sdk.CodeUnknownField
+	}
+	switch {
+	case lost && !force:
+		fmt.Fprintf(stderr, "%s: not migrated, as unknown fields would be lost; remove them or use -force\n", file)
+		return 1
+	case len(errs) > 0:
+		// Other errors are carried over unchanged, so are no reason not to migrate
+		fmt.Fprintf(stderr, "%s: the flags have errors, which migrating does not fix\n", file)
+	}
+
+	migrated, err := sdk.Migrate(data, format)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to migrate flags: %v\n", err)
+		return 1
+	}
+
+	if dryRun {
+		stdout.Write(migrated)
+		return 0
+	}
+	if err := fsutil.WriteFileAtomic(file, migrated, info.Mode().Perm()); err != nil {
+		fmt.Fprintf(stderr, "failed to write flags: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "%s: migrated to $schemaVersion %d\n", file, sdk.CurrentSchemaVersion)
+	return 0
+}
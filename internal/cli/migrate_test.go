@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate_RewritesInPlace(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "flags.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+new_ui:
+  enabled: true
+  rules:
+    - if:
+        env: prod
+      value: false
+`), 0600))
+
+	stdout := new(bytes.Buffer)
+	code := RunRoot([]string{"migrate", "-file", path}, stdout, io.Discard)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout.String(), "migrated to $schemaVersion 2")
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// The rewritten file is now a clean v2 document
+	stdout.Reset()
+	code = Validate([]string{"-file", path, "-warnings-as-errors"}, stdout, io.Discard)
+	assert.Equal(t, 0, code, stdout.String())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "$schemaVersion: 2")
+	assert.Contains(t, string(data), "defaultVariant: \"on\"")
+
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 1, "no temporary files are left behind")
+}
+
+func TestMigrate_DryRun(t *testing.T) {
+	path := writeTempFlags(t, `{ "beta": { "enabled": false } }`)
+
+	stdout := new(bytes.Buffer)
+	code := Migrate([]string{"-file", path, "-dry-run"}, stdout, io.Discard)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout.String(), `"$schemaVersion": 2`)
+
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, `{ "beta": { "enabled": false } }`, string(data))
+}
+
+func TestMigrate_RefusesToDropUnknownFields(t *testing.T) {
+	original := `{ "beta": { "enabled": false, "colour": "red" } }`
+	path := writeTempFlags(t, original)
+
+	stderr := new(bytes.Buffer)
+	assert.Equal(t, 1, Migrate([]string{"-file", path}, io.Discard, stderr))
+	assert.Contains(t, stderr.String(), `error: beta.colour: unknown field "colour"`)
+	assert.Contains(t, stderr.String(), "not migrated")
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, original, string(data))
+
+	stderr.Reset()
+	assert.Equal(t, 0, Migrate([]string{"-file", path, "-force"}, io.Discard, stderr))
+	assert.Contains(t, stderr.String(), `beta.colour`)
+	data, _ = os.ReadFile(path)
+	assert.NotContains(t, string(data), "colour")
+}
+
+func TestMigrate_KeepsOtherErrors(t *testing.T) {
+	path := writeTempFlags(t, `{ "beta": { "variants": { "on": true }, "defaultVariant": "off" } }`)
+
+	stderr := new(bytes.Buffer)
+	assert.Equal(t, 0, Migrate([]string{"-file", path}, io.Discard, stderr))
+	assert.Contains(t, stderr.String(), `error: beta.defaultVariant`)
+	assert.Contains(t, stderr.String(), "migrating does not fix")
+	data, _ := os.ReadFile(path)
+	assert.Contains(t, string(data), `"$schemaVersion": 2`)
+}
+
+func TestMigrate_Errors(t *testing.T) {
+	stderr := new(bytes.Buffer)
+	assert.Equal(t, 1, Migrate([]string{"-file", "nonexistent.json"}, io.Discard, stderr))
+	assert.Contains(t, stderr.String(), "failed to read flags")
+
+	stderr.Reset()
+	path := writeTempFlags(t, `{ "$schemaVersion": 9 }`)
+	assert.Equal(t, 1, Migrate([]string{"-file", path}, io.Discard, stderr))
+	assert.Contains(t, stderr.String(), "failed to migrate flags: unsupported $schemaVersion 9")
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"bytes"
+	"compress/gzip"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// minCompressSize is the smallest response worth compressing
+const minCompressSize = 1024
+
+// encodings are the content codings responses can be compressed with, the first being preferred when a client
+// accepts several equally
+var encodings = []string{"zstd", "gzip"}
+
+// zstdEncoder compresses with zstd; EncodeAll is safe to call from several requests at once
+var zstdEncoder, _ = zstd.NewWriter(nil)
+
+// formatMediaTypes are the media types accepted for each format, the first being the one sent
+var formatMediaTypes = map[string][]string{
+	"json": {"application/json"},
+	"yaml": {"application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml"},
+}
+
+// acceptRange is one entry of an Accept or Accept-Encoding header
+type acceptRange struct {
+	value string
+	q     float64
+}
+
+// parseAccept parses an Accept or Accept-Encoding header. Entries without a valid quality have a quality of 1.
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		value, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			// Accept-Encoding values, such as "gzip", are not media types
+			value, _, _ = strings.Cut(part, ";")
+			value = strings.ToLower(strings.TrimSpace(value))
+			params = map[string]string{}
+			if _, q, found := strings.Cut(part, "q="); found {
+				params["q"] = strings.TrimSpace(q)
+			}
+		}
+		r := acceptRange{value: value, q: 1}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			r.q = q
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// quality is how acceptable a media type is to the ranges, using the most specific range which matches it
+func quality(ranges []acceptRange, mediaType string) float64 {
+	best, specificity := 0.0, -1
+	major, _, _ := strings.Cut(mediaType, "/")
+	for _, r := range ranges {
+		s := -1
+		switch r.value {
+		case mediaType:
+			s = 2
+		case major + "/*":
+			s = 1
+		case "*/*", "*":
+			s = 0
+		}
+		if s > specificity {
+			best, specificity = r.q, s
+		}
+	}
+	return best
+}
+
+// negotiateFormat picks the format a client prefers from its Accept header: JSON unless it prefers YAML
+func negotiateFormat(accept string) string {
+	if accept == "" {
+		return "json"
+	}
+	ranges := parseAccept(accept)
+	scores := map[string]float64{}
+	for _, format := range []string{"json", "yaml"} {
+		for _, mediaType := range formatMediaTypes[format] {
+			scores[format] = max(scores[format], quality(ranges, mediaType))
+		}
+	}
+	if scores["yaml"] > scores["json"] {
+		return "yaml"
+	}
+	return "json"
+}
+
+// negotiateEncoding picks the encoding a client prefers from its Accept-Encoding header, or "" when it accepts none
+func negotiateEncoding(acceptEncoding string) string {
+	ranges := parseAccept(acceptEncoding)
+	best, bestQ := "", 0.0
+	for _, encoding := range encodings {
+		if q := quality(ranges, encoding); q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compress compresses data with one of the encodings
+func compress(data []byte, encoding string) []byte {
+	if encoding == "zstd" {
+		return zstdEncoder.EncodeAll(data, make([]byte, 0, len(data)))
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, _ = w.Write(data)
+	_ = w.Close()
+	return buf.Bytes()
+}
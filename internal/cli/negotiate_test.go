@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "json"},
+		{"*/*", "json"},
+		{"application/json", "json"},
+		{"application/yaml", "yaml"},
+		{"text/yaml", "yaml"},
+		{"application/x-yaml, */*;q=0.1", "yaml"},
+		{"application/json;q=0.5, application/yaml", "yaml"},
+		{"application/json, application/yaml;q=0.9", "json"},
+		{"text/*", "yaml"},
+		{"text/html", "json"}, // nothing acceptable: JSON anyway
+		{"*/*, application/json;q=0", "yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			assert.Equal(t, tt.want, negotiateFormat(tt.accept))
+		})
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                              "",
+		"gzip":                          "gzip",
+		"deflate, gzip;q=1":             "gzip",
+		"br;q=1.0, gzip;q=0.8, *;q=0.1": "gzip",
+		"gzip;q=0":                      "",
+		"*":                             "zstd",
+		"*, zstd;q=0":                   "gzip",
+		"identity":                      "",
+		"gzip, deflate, br, zstd":       "zstd",
+		"zstd;q=0.5, gzip":              "gzip",
+	}
+	for header, want := range tests {
+		t.Run(header, func(t *testing.T) {
+			assert.Equal(t, want, negotiateEncoding(header))
+		})
+	}
+}
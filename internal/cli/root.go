@@ -12,6 +12,12 @@ func RunRoot(args []string, stdout, stderr io.Writer) int {
 	switch args[0] {
 	case "serve":
 		return Serve(args[1:], stdout, stderr)
+	case "validate":
+		return Validate(args[1:], stdout, stderr)
+	case "schema":
+		return Schema(args[1:], stdout, stderr)
+	case "migrate":
+		return Migrate(args[1:], stdout, stderr)
 	default:
 		return Run(args, stdout, stderr)
 	}
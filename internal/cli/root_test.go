@@ -2,9 +2,11 @@ package cli
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/tommed/ducto-featureflags/test"
+	"io"
 	"testing"
 )
 
@@ -25,3 +27,13 @@ func TestRunRoot_ListFlags(t *testing.T) {
 	assert.Contains(t, output, `"foo"`)
 	assert.Contains(t, output, `"defaultVariant": "yes"`)
 }
+
+func TestRunRoot_Schema(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	code := RunRoot([]string{"schema"}, stdout, io.Discard)
+
+	assert.Equal(t, 0, code)
+	var schema map[string]interface{}
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &schema))
+	assert.Contains(t, schema, "$defs")
+}
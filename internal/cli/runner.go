@@ -18,11 +18,13 @@ func Run(args []string, stdout, stderr io.Writer) int {
 	var key string
 	var printAll bool
 	var ctxFlags arrayFlags
+	var load loadFlags
 
 	fs.StringVar(&file, "file", "flags.json", "Path to feature flag definition file")
 	fs.StringVar(&key, "key", "", "Feature flag key to check")
 	fs.BoolVar(&printAll, "list", false, "Print all loaded flags")
 	fs.Var(&ctxFlags, "ctx", "Context key=value pair (can be used multiple times)")
+	load.register(fs)
 	if err := fs.Parse(args); err != nil {
 		fmt.Fprintf(stderr, "failed to parse args: %v\n", err)
 		return 1
@@ -38,11 +40,12 @@ func Run(args []string, stdout, stderr io.Writer) int {
 		return 1
 	}
 
-	store, err := sdk.NewStoreFromFile(file)
+	store, err := sdk.NewStoreFromFile(file, load.options()...)
 	if err != nil {
 		fmt.Fprintf(stderr, "failed to load flags: %v", err)
 		return 1
 	}
+	printDiagnostics(stderr, file, store.Diagnostics())
 
 	if printAll {
 		dumpAllFlags(stdout, store)
@@ -50,12 +53,12 @@ func Run(args []string, stdout, stderr io.Writer) int {
 	}
 
 	ctx := parseContext(ctxFlags)
-	flagFromStore, ok := store.Get(key)
+	// Evaluated through the store, so the result carries the generation of the flags
+	result, ok := store.Evaluate(key, ctx)
 	if !ok {
 		fmt.Fprintf(stderr, "failed to get flag: %v", err)
 		return 1
 	}
-	result := flagFromStore.Evaluate(ctx)
 	if !result.OK {
 		fmt.Fprintf(stderr, "failed to evaluate flag: %v", err)
 		return 1
@@ -33,6 +33,7 @@ func TestRun_QuerySingleFlag(t *testing.T) {
 
 	assert.Equal(t, 0, code)
 	assert.Contains(t, stdout.String(), `"Variant":"yes","Value":true`)
+	assert.Contains(t, stdout.String(), `"Generation":1`)
 }
 
 func TestRun_MissingKeyAndList(t *testing.T) {
@@ -111,3 +112,60 @@ func TestRun_WithContextEvaluation(t *testing.T) {
 	assert.Equal(t, 0, code)
 	assert.Contains(t, stdout.String(), `"canary_mode","result":{"Variant":"yes","Value":true`)
 }
+
+func TestRun_WithEnvironment(t *testing.T) {
+	flags := `{
+		"beta": {
+			"variants": ` + test.BoolVariantsJSON() + `,
+			"defaultVariant": "no",
+			"environments": {
+				"dev": { "defaultVariant": "yes" }
+			}
+		}
+	}`
+	path := writeTempFlags(t, flags)
+
+	stdout := new(bytes.Buffer)
+	code := Run([]string{"-file", path, "-key", "beta"}, stdout, io.Discard)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout.String(), `"Variant":"no","Value":false`)
+
+	stdout.Reset()
+	code = Run([]string{"-file", path, "-key", "beta", "-env", "dev"}, stdout, io.Discard)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout.String(), `"Variant":"yes","Value":true`)
+}
+
+func TestRun_Strict(t *testing.T) {
+	flags := `{
+		"beta": { "variants": ` + test.BoolVariantsJSON() + `, "defaultVariant": "yes", "rules": [{ "variant": "missing" }] }
+	}`
+	path := writeTempFlags(t, flags)
+
+	stderr := new(bytes.Buffer)
+	code := Run([]string{"-file", path, "-key", "beta"}, io.Discard, stderr)
+	assert.Equal(t, 1, code, "the rule matches a missing variant")
+	assert.Contains(t, stderr.String(), `error: beta.rules[0].variant: variant "missing" is not defined`)
+
+	stderr.Reset()
+	code = Run([]string{"-file", path, "-key", "beta", "-strict"}, io.Discard, stderr)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), "failed to load flags: invalid flags")
+}
+
+func TestRun_StrictFields(t *testing.T) {
+	flags := `{
+		"beta": { "variants": ` + test.BoolVariantsJSON() + `, "defaultvariant": "yes" }
+	}`
+	path := writeTempFlags(t, flags)
+
+	stderr := new(bytes.Buffer)
+	code := Run([]string{"-file", path, "-key", "beta"}, io.Discard, stderr)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stderr.String(), `warning: beta.defaultvariant: unknown field`)
+
+	stderr.Reset()
+	code = Run([]string{"-file", path, "-key", "beta", "-strict-fields"}, io.Discard, stderr)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), "failed to load flags: invalid flags")
+}
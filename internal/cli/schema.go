@@ -0,0 +1,13 @@
+package cli
+
+import (
+	"io"
+
+	"github.com/tommed/ducto-featureflags/sdk"
+)
+
+// Schema prints the JSON Schema of the flag file format
+func Schema(_ []string, stdout, _ io.Writer) int {
+	_, _ = stdout.Write(sdk.JSONSchemaBytes())
+	return 0
+}
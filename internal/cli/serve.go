@@ -1,7 +1,11 @@
 package cli
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -9,10 +13,14 @@ import (
 	"gopkg.in/yaml.v3"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/tommed/ducto-featureflags/internal/tlsutil"
 	"github.com/tommed/ducto-featureflags/sdk"
 )
 
@@ -23,6 +31,27 @@ type ResolutionResponse struct {
 	Error   string      `json:"error,omitempty"`
 }
 
+// StatusResponse is the health of the flags being served, from GET /api/status
+type StatusResponse struct {
+	State               sdk.State  `json:"state"`
+	LastSuccess         *time.Time `json:"lastSuccess,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+	LastErrorAt         *time.Time `json:"lastErrorAt,omitempty"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+}
+
+func newStatusResponse(status sdk.Status) StatusResponse {
+	resp := StatusResponse{State: status.State, ConsecutiveFailures: status.ConsecutiveFailures}
+	if !status.LastSuccess.IsZero() {
+		resp.LastSuccess = &status.LastSuccess
+	}
+	if status.LastError != nil {
+		resp.LastError = status.LastError.Error()
+		resp.LastErrorAt = &status.LastErrorAt
+	}
+	return resp
+}
+
 //goland:noinspection GoUnhandledErrorResult
 func Serve(args []string, stdout, stderr io.Writer) int {
 	fs := flag.NewFlagSet("serve", flag.ExitOnError)
@@ -30,96 +59,140 @@ func Serve(args []string, stdout, stderr io.Writer) int {
 	var file string
 	var addr string
 	var token string
+	var staleAfter time.Duration
+	var poll time.Duration
+	var tlsFiles tlsutil.Files
+	var requireClientCert bool
+	var load loadFlags
 
-	fs.StringVar(&file, "file", "flags.json", "Path to feature flag definition file")
+	fs.StringVar(&file, "file", "flags.json", "Path to feature flag definition file, or a directory or glob pattern of them")
 	fs.StringVar(&addr, "addr", ":8080", "Listen address")
 	fs.StringVar(&token, "token", "", "Optional bearer token required to access the API")
+	fs.DurationVar(&poll, "poll", 0, "Poll the flag file for changes at this interval, instead of using file system notifications")
+	fs.DurationVar(&staleAfter, "stale-after", 0, "Report the flags as STALE when not reloaded for this long (0 disables)")
+	fs.StringVar(&tlsFiles.CertFile, "tls-cert", "", "Serve HTTPS with this PEM certificate (reloaded when it changes)")
+	fs.StringVar(&tlsFiles.KeyFile, "tls-key", "", "The PEM private key of -tls-cert")
+	fs.StringVar(&tlsFiles.CAFile, "tls-client-ca", "", "Verify client certificates against the CAs in this PEM file")
+	fs.BoolVar(&requireClientCert, "tls-require-client-cert", false, "Reject clients without a certificate signed by -tls-client-ca (mutual TLS)")
+	load.register(fs)
 
 	if err := fs.Parse(args); err != nil {
 		fmt.Fprintf(stderr, "failed to parse serve flags: %v\n", err)
 		return 1
 	}
 
+	var tlsConfig *tls.Config
+	if !tlsFiles.Empty() || requireClientCert {
+		reloader, err := tlsutil.NewReloader(tlsFiles)
+		if err == nil {
+			tlsConfig, err = reloader.ServerConfig(requireClientCert)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to configure TLS: %v\n", err)
+			return 1
+		}
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	provider := sdk.NewFileProviderWithLog(file, stdout)
-	store := sdk.NewDynamicStore(ctx, provider)
+	opts := load.options()
+	if poll > 0 {
+		opts = append(opts, sdk.WithPolling(poll))
+	}
+	provider := newProvider(file, stdout, opts)
+	store := sdk.NewDynamicStore(ctx, provider, sdk.WithStalenessThreshold(staleAfter))
 	err := store.Start()
 	if err != nil {
 		fmt.Fprintf(stderr, "failed to load flags: %v\n", err)
 		return 1
 	}
+	defer store.Close()
+	store.SubscribeRejections(func(r sdk.RejectedReload) {
+		fmt.Fprintf(stdout, "reload rejected, still serving the previous flags: %v\n", r.Err)
+	})
 
 	mux := http.NewServeMux()
-	var handler = func(encode func(w http.ResponseWriter, graph interface{})) http.HandlerFunc {
+	var authorized = func(w http.ResponseWriter, r *http.Request) bool {
+		if token != "" {
+			auth := r.Header.Get("Authorization")
+			expected := "Bearer " + token
+			if auth != expected {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return false
+			}
+		}
+		return true
+	}
+	// handler serves the flags in the given format, or if none is given, the one negotiated with the client
+	var handler = func(format string) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			if token != "" {
-				auth := r.Header.Get("Authorization")
-				expected := "Bearer " + token
-				if auth != expected {
-					http.Error(w, "unauthorized", http.StatusUnauthorized)
-					return
-				}
+			if !authorized(w, r) {
+				return
 			}
 
-			// Handle If-Modified-Since and 304s
-			ifModified := r.Header.Get("If-Modified-Since")
-			if ifModified != "" {
-				if t, err := http.ParseTime(ifModified); err == nil {
-					if !store.LastUpdated().IsZero() && store.LastUpdated().Before(t.Add(1*time.Second)) {
-						w.WriteHeader(http.StatusNotModified)
-						return
-					}
-				}
+			// Render the response first, so its ETag is the hash of exactly what would be sent
+			f := format
+			if f == "" {
+				f = negotiateFormat(r.Header.Get("Accept"))
+				w.Header().Add("Vary", "Accept")
 			}
-			w.Header().Set("Last-Modified", store.LastUpdated().UTC().Format(http.TimeFormat))
-
-			// Fetch the eval context from the query-string
-			key := r.URL.Query().Get("key")
-			if key != "" {
-				// Convert query params to EvalContext
-				ctx := sdk.EvalContext{}
-				for k, v := range r.URL.Query() {
-					if len(v) > 0 {
-						ctx[k] = v[0]
-					}
-				}
-
-				// Determine what to send back
-				storeFlag, ok := store.Get(key)
-				if !ok {
-					encode(w, ResolutionResponse{
-						Variant: "",
-						Value:   false,
-						Reason:  "ERROR",
-						Error:   "flag not found",
-					})
-					return
-				}
-
-				result := storeFlag.Evaluate(ctx)
-				resp := ResolutionResponse{
-					Variant: result.Variant,
-					Value:   result.Value,
-					Reason:  "FALLBACK",
-				}
-				if result.Matched {
-					resp.Reason = "TARGETING_MATCH"
-				}
-				encode(w, resp)
-				return
+			var body bytes.Buffer
+			encoders[f](&body, resolve(store, r.URL.Query()))
+			data := body.Bytes()
+			etag := etagFor(data)
+			w.Header().Add("Vary", "Accept-Encoding")
+			if encoding := negotiateEncoding(r.Header.Get("Accept-Encoding")); encoding != "" && len(data) >= minCompressSize {
+				data = compress(data, encoding)
+				etag = strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+				w.Header().Set("Content-Encoding", encoding)
 			}
+			lastModified := store.LastUpdated()
 
-			// Just list all flags
-			encode(w, store.AllFlags())
+			w.Header().Set("Content-Type", formatMediaTypes[f][0])
+			w.Header().Set("ETag", etag)
+			if !lastModified.IsZero() {
+				w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+			}
+			if notModified(r, etag, lastModified) {
+				w.Header().Del("Content-Encoding")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			_, _ = w.Write(data)
 		}
 	}
-	mux.HandleFunc("/api/flags", handler(handleJSON))
-	mux.HandleFunc("/api/flags.yaml", handler(handleYAML))
-	mux.HandleFunc("/api/flags.json", handler(handleJSON))
+	mux.HandleFunc("/api/flags", handler(""))
+	mux.HandleFunc("/api/flags.yaml", handler("yaml"))
+	mux.HandleFunc("/api/flags.json", handler("json"))
+	mux.HandleFunc("/api/status", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		status := store.Status()
+		w.Header().Set("Content-Type", "application/json")
+		if status.State != sdk.StateReady && status.State != sdk.StateStale {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(newStatusResponse(status))
+	})
+	hub := newStreamHub(ctx, store)
+	mux.HandleFunc("/api/stream", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		hub.handle(w, r)
+	})
+	mux.HandleFunc("/api/schema", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/schema+json")
+		_, _ = w.Write(sdk.JSONSchemaBytes())
+	})
 
 	server := &http.Server{
-		Addr:    addr,
-		Handler: mux,
+		Addr:      addr,
+		Handler:   mux,
+		TLSConfig: tlsConfig,
 	}
 	go func() {
 		<-ctx.Done()
@@ -128,7 +201,13 @@ func Serve(args []string, stdout, stderr io.Writer) int {
 	}()
 
 	fmt.Fprintf(stdout, "Listening on %s...\n", addr)
-	if err := server.ListenAndServe(); err != nil {
+	if tlsConfig != nil {
+		// The certificates come from the TLS config, so they can be reloaded
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil {
 		if !errors.Is(err, http.ErrServerClosed) {
 			fmt.Fprintf(stderr, "server failed: %v", err)
 			return 1
@@ -138,12 +217,112 @@ func Serve(args []string, stdout, stderr io.Writer) int {
 	return 0
 }
 
-func handleJSON(w http.ResponseWriter, graph interface{}) {
+// resolve evaluates the flag given by the "key" query parameter, using the other parameters as its
+// context, or else lists all flags, optionally only those with every requested tag
+func resolve(store sdk.AnyStore, query url.Values) interface{} {
+	key := query.Get("key")
+	if key == "" {
+		return filterByTags(store.AllFlags(), query["tag"])
+	}
+
+	// Convert query params to EvalContext
+	ctx := sdk.EvalContext{}
+	for k, v := range query {
+		if len(v) > 0 {
+			ctx[k] = v[0]
+		}
+	}
+
+	// Determine what to send back
+	storeFlag, ok := store.Get(key)
+	if !ok {
+		return ResolutionResponse{
+			Variant: "",
+			Value:   false,
+			Reason:  "ERROR",
+			Error:   "flag not found",
+		}
+	}
+
+	result := storeFlag.Evaluate(ctx)
+	resp := ResolutionResponse{
+		Variant: result.Variant,
+		Value:   result.Value,
+		Reason:  "FALLBACK",
+	}
+	if result.Matched {
+		resp.Reason = "TARGETING_MATCH"
+	}
+	return resp
+}
+
+// etagFor is a strong ETag for a response body
+func etagFor(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified reports whether a conditional request already has the current response.
+// If-None-Match takes precedence; If-Modified-Since is only used by clients which send no ETag.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Last-Modified only has a precision of one second, so this can miss a second change within the same second
+	if lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !lastModified.Truncate(time.Second).After(since)
+}
+
+// newProvider watches a single flag file, or merges every flag file in a directory or matching a glob pattern
+func newProvider(file string, log io.Writer, opts []sdk.Option) sdk.StoreProvider {
+	if info, err := os.Stat(file); (err == nil && info.IsDir()) || strings.ContainsAny(file, "*?[") {
+		return sdk.NewDirProviderWithLog(file, log, opts...)
+	}
+	return sdk.NewFileProviderWithLog(file, log, opts...)
+}
+
+func filterByTags(flags map[string]sdk.Flag, tags []string) map[string]sdk.Flag {
+	if len(tags) == 0 {
+		return flags
+	}
+	filtered := make(map[string]sdk.Flag)
+	for key, f := range flags {
+		matches := true
+		for _, tag := range tags {
+			if !f.HasTag(tag) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			filtered[key] = f
+		}
+	}
+	return filtered
+}
+
+// encoders write a response in each format
+var encoders = map[string]func(w io.Writer, graph interface{}){
+	"json": handleJSON,
+	"yaml": handleYAML,
+}
+
+func handleJSON(w io.Writer, graph interface{}) {
 	e := json.NewEncoder(w)
 	e.SetIndent("", "  ")
 	_ = e.Encode(graph)
 }
 
-func handleYAML(w http.ResponseWriter, graph interface{}) {
+func handleYAML(w io.Writer, graph interface{}) {
 	_ = yaml.NewEncoder(w).Encode(graph)
 }
@@ -2,9 +2,15 @@ package cli
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tommed/ducto-featureflags/sdk"
 	"github.com/tommed/ducto-featureflags/test"
 	"gopkg.in/yaml.v3"
 	"io"
@@ -137,3 +143,331 @@ func TestServe_WithToken_EnforcesAuth(t *testing.T) {
 	defer resp2.Body.Close()
 	assert.Equal(t, http.StatusOK, resp2.StatusCode)
 }
+
+func TestFilterByTags(t *testing.T) {
+	flags := map[string]sdk.Flag{
+		"a": {Tags: []string{"ui", "beta"}},
+		"b": {Tags: []string{"ui"}},
+		"c": {},
+	}
+
+	assert.Len(t, filterByTags(flags, nil), 3)
+	assert.Len(t, filterByTags(flags, []string{"ui"}), 2)
+
+	both := filterByTags(flags, []string{"ui", "beta"})
+	assert.Len(t, both, 1)
+	assert.Contains(t, both, "a")
+
+	assert.Empty(t, filterByTags(flags, []string{"missing"}))
+}
+
+//goland:noinspection GoUnhandledErrorResult
+func TestServe_Schema_E2E(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e tests in short mode")
+	}
+	file := writeTempFlags(t, `{
+		"my_flag": { "variants": `+test.BoolVariantsJSON()+`, "defaultVariant": "no" }
+	}`)
+
+	port := "9192"
+	go Serve([]string{"-file", file, "-addr", ":" + port}, io.Discard, io.Discard)
+	time.Sleep(300 * time.Millisecond) // wait for server to bind
+
+	resp, err := http.Get("http://localhost:" + port + "/api/schema")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/schema+json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, string(sdk.JSONSchemaBytes()), string(body))
+}
+
+//goland:noinspection GoUnhandledErrorResult
+func TestServe_Status_E2E(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e tests in short mode")
+	}
+	file := writeTempFlags(t, `{
+		"my_flag": { "variants": `+test.BoolVariantsJSON()+`, "defaultVariant": "no" }
+	}`)
+
+	port := "9193"
+	go Serve([]string{"-file", file, "-addr", ":" + port}, io.Discard, io.Discard)
+	time.Sleep(300 * time.Millisecond) // wait for server to bind
+
+	getStatus := func() (int, StatusResponse) {
+		resp, err := http.Get("http://localhost:" + port + "/api/status")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var status StatusResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+		return resp.StatusCode, status
+	}
+
+	code, status := getStatus()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, sdk.StateReady, status.State)
+	assert.NotNil(t, status.LastSuccess)
+	assert.Empty(t, status.LastError)
+
+	// A broken file keeps the last good flags, but they are now stale
+	require.NoError(t, os.WriteFile(file, []byte(`{ BROKEN`), 0644))
+	time.Sleep(500 * time.Millisecond)
+
+	code, status = getStatus()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, sdk.StateStale, status.State)
+	assert.GreaterOrEqual(t, status.ConsecutiveFailures, 1)
+	assert.Contains(t, status.LastError, "parse JSON")
+	assert.NotNil(t, status.LastErrorAt)
+}
+
+func TestNewStatusResponse(t *testing.T) {
+	assert.Equal(t, StatusResponse{State: sdk.StateNotReady}, newStatusResponse(sdk.Status{State: sdk.StateNotReady}))
+
+	now := time.Now()
+	resp := newStatusResponse(sdk.Status{
+		State:               sdk.StateError,
+		LastError:           errors.New("boom"),
+		LastErrorAt:         now,
+		ConsecutiveFailures: 2,
+	})
+	assert.Equal(t, "boom", resp.LastError)
+	assert.Equal(t, &now, resp.LastErrorAt)
+	assert.Nil(t, resp.LastSuccess)
+	assert.Equal(t, 2, resp.ConsecutiveFailures)
+}
+
+func TestNewProvider(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.json"), []byte(`{
+		"a": { "variants": `+test.BoolVariantsJSON()+`, "defaultVariant": "yes" }
+	}`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.json"), []byte(`{
+		"b": { "variants": `+test.BoolVariantsJSON()+`, "defaultVariant": "yes" }
+	}`), 0644))
+
+	for _, file := range []string{dir, filepath.Join(dir, "*.json")} {
+		store, err := newProvider(file, io.Discard, nil).Load(context.Background())
+		require.NoError(t, err, file)
+		assert.Len(t, store.AllFlags(), 2, file)
+	}
+
+	store, err := newProvider(filepath.Join(dir, "a.json"), io.Discard, nil).Load(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, store.AllFlags(), 1)
+}
+
+func TestNotModified(t *testing.T) {
+	updated := time.Date(2024, 5, 1, 12, 0, 0, 500_000_000, time.UTC)
+	etag := etagFor([]byte(`{}`))
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    bool
+	}{
+		{"unconditional", nil, false},
+		{"matching etag", map[string]string{"If-None-Match": etag}, true},
+		{"weak etag", map[string]string{"If-None-Match": "W/" + etag}, true},
+		{"one of several", map[string]string{"If-None-Match": `"other", ` + etag}, true},
+		{"any", map[string]string{"If-None-Match": "*"}, true},
+		{"different etag", map[string]string{"If-None-Match": `"other"`}, false},
+		{"etag takes precedence", map[string]string{
+			"If-None-Match":     `"other"`,
+			"If-Modified-Since": updated.Add(time.Hour).Format(http.TimeFormat),
+		}, false},
+		{"modified since", map[string]string{"If-Modified-Since": updated.Add(-time.Second).Format(http.TimeFormat)}, false},
+		{"same second", map[string]string{"If-Modified-Since": updated.Format(http.TimeFormat)}, true},
+		{"bad date", map[string]string{"If-Modified-Since": "yesterday"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest(http.MethodGet, "/api/flags", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			assert.Equal(t, tt.want, notModified(r, etag, updated))
+		})
+	}
+	assert.NotEqual(t, etag, etagFor([]byte(`{ }`)))
+}
+
+//goland:noinspection GoUnhandledErrorResult
+func TestServe_ETag_E2E(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e tests in short mode")
+	}
+	file := writeTempFlags(t, `{
+		"my_flag": { "variants": `+test.BoolVariantsJSON()+`, "defaultVariant": "no" }
+	}`)
+
+	port := "9194"
+	go Serve([]string{"-file", file, "-addr", ":" + port}, io.Discard, io.Discard)
+	time.Sleep(300 * time.Millisecond) // wait for server to bind
+
+	get := func(etag string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, "http://localhost:"+port+"/api/flags", nil)
+		require.NoError(t, err)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+
+	first := get("")
+	assert.Equal(t, http.StatusOK, first.StatusCode)
+	etag := first.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.NotEmpty(t, first.Header.Get("Last-Modified"))
+
+	resp := get(etag)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	assert.Equal(t, etag, resp.Header.Get("ETag"))
+
+	// A change within the same second as the last one is still noticed
+	require.NoError(t, os.WriteFile(file, []byte(`{
+		"my_flag": { "variants": `+test.BoolVariantsJSON()+`, "defaultVariant": "yes" }
+	}`), 0644))
+	time.Sleep(300 * time.Millisecond)
+
+	resp = get(etag)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+}
+
+//goland:noinspection GoUnhandledErrorResult
+func TestServe_MutualTLS_E2E(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e tests in short mode")
+	}
+	file := writeTempFlags(t, `{
+		"my_flag": { "variants": `+test.BoolVariantsJSON()+`, "defaultVariant": "yes" }
+	}`)
+	dir := t.TempDir()
+	ca := test.NewCA(t, "ca")
+	caFile := filepath.Join(dir, "ca.pem")
+	ca.WriteCA(t, caFile)
+	serverCert, serverKey := ca.WriteCert(t, dir, "server")
+	clientCert, clientKey := ca.WriteCert(t, dir, "client")
+
+	port := "9195"
+	go Serve([]string{"-file", file, "-addr", ":" + port,
+		"-tls-cert", serverCert, "-tls-key", serverKey, "-tls-client-ca", caFile, "-tls-require-client-cert",
+	}, io.Discard, io.Discard)
+	time.Sleep(300 * time.Millisecond) // wait for server to bind
+
+	url := "https://localhost:" + port + "/api/flags"
+	store, err := sdk.NewStoreFromURL(context.Background(), url, "", sdk.WithTLSCA(caFile), sdk.WithTLSClientCert(clientCert, clientKey))
+	require.NoError(t, err)
+	_, ok := store.Get("my_flag")
+	assert.True(t, ok)
+
+	_, err = sdk.NewStoreFromURL(context.Background(), url, "", sdk.WithTLSCA(caFile))
+	assert.Error(t, err, "a client certificate is required")
+}
+
+func TestServe_TLSFlagErrors(t *testing.T) {
+	file := writeTempFlags(t, `{}`)
+	stderr := new(bytes.Buffer)
+	code := Serve([]string{"-file", file, "-tls-require-client-cert"}, io.Discard, stderr)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), "failed to configure TLS")
+}
+
+func TestServe_Stream_E2E(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e tests in short mode")
+	}
+	file := writeTempFlags(t, `{
+		"my_flag": { "variants": `+test.BoolVariantsJSON()+`, "defaultVariant": "no" }
+	}`)
+
+	port := "9196"
+	go Serve([]string{"-file", file, "-addr", ":" + port, "-token", "secret"}, io.Discard, io.Discard)
+	time.Sleep(300 * time.Millisecond) // wait for server to bind
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	base := "http://localhost:" + port + "/api/"
+	store := sdk.NewDynamicStore(ctx, sdk.NewStreamProvider(base+"stream", base+"flags", "secret", time.Hour))
+	require.NoError(t, store.Start())
+	defer store.Close()
+	time.Sleep(100 * time.Millisecond) // let the stream connect
+
+	// Changes arrive without waiting for the next poll, an hour away
+	require.NoError(t, os.WriteFile(file, []byte(`{
+		"my_flag": { "variants": `+test.BoolVariantsJSON()+`, "defaultVariant": "yes" }
+	}`), 0644))
+	assert.Eventually(t, func() bool {
+		f, _ := store.Get("my_flag")
+		return f.DefaultVariant == "yes"
+	}, 2*time.Second, 20*time.Millisecond)
+	assert.Equal(t, sdk.StateReady, store.Status().State)
+}
+
+//goland:noinspection GoUnhandledErrorResult
+func TestServe_ContentNegotiation_E2E(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping e2e tests in short mode")
+	}
+	flags := map[string]interface{}{}
+	for i := 0; i < 50; i++ { // large enough to be compressed
+		flags[fmt.Sprintf("flag_%d", i)] = map[string]interface{}{"variants": test.BoolVariants(), "defaultVariant": "no"}
+	}
+	file := writeTempFlags(t, test.Encode(flags, "json"))
+
+	port := "9197"
+	go Serve([]string{"-file", file, "-addr", ":" + port}, io.Discard, io.Discard)
+	time.Sleep(300 * time.Millisecond) // wait for server to bind
+	url := "http://localhost:" + port + "/api/flags"
+
+	// Asking for our own encoding stops the transport from decompressing the response
+	get := func(accept, encoding string) (*http.Response, []byte) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		req.Header.Set("Accept", accept)
+		req.Header.Set("Accept-Encoding", encoding)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, body
+	}
+
+	resp, body := get("application/yaml", "identity")
+	assert.Equal(t, "application/yaml", resp.Header.Get("Content-Type"))
+	var decoded map[string]sdk.Flag
+	require.NoError(t, yaml.Unmarshal(body, &decoded))
+	assert.Len(t, decoded, 50)
+
+	resp, body = get("application/json", "gzip")
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Contains(t, resp.Header.Get("ETag"), "-gzip")
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	require.NoError(t, json.NewDecoder(reader).Decode(&decoded))
+	assert.Len(t, decoded, 50)
+
+	resp, body = get("application/json", "gzip;q=0.5, zstd")
+	assert.Equal(t, "zstd", resp.Header.Get("Content-Encoding"))
+	assert.Contains(t, resp.Header.Get("ETag"), "-zstd")
+	decoder, err := zstd.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	defer decoder.Close()
+	require.NoError(t, json.NewDecoder(decoder).Decode(&decoded))
+	assert.Len(t, decoded, 50)
+
+	// The provider negotiates, decompresses and detects the format without a file extension
+	store, err := sdk.NewStoreFromURL(context.Background(), url, "")
+	require.NoError(t, err)
+	assert.Len(t, store.AllFlags(), 50)
+}
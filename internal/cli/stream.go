@@ -0,0 +1,193 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tommed/ducto-featureflags/sdk"
+)
+
+const (
+	maxStreamDeltas     = 100 // recent changes kept, so reconnecting clients only need what they missed
+	streamClientBuffer  = 16  // events queued for a client before it is disconnected as too slow
+	streamHeartbeatEach = 15 * time.Second
+)
+
+// sseEvent is an event ready to be sent on the flag stream
+type sseEvent struct {
+	name       string
+	generation uint64
+	data       []byte
+}
+
+// streamClient is a connection to the flag stream
+type streamClient struct {
+	events chan sseEvent
+	after  uint64 // the generation the client already has
+}
+
+// streamHub sends changes to the flags of a store to every client of GET /api/stream, as Server-Sent Events.
+// A new client receives a snapshot of every flag, then a delta for each change. A client which reconnects with
+// the ID of the last event it received is sent only the deltas it missed, if they are still known.
+type streamHub struct {
+	ctx   context.Context // ends every stream when done
+	store sdk.AnyStore
+	epoch string // distinguishes this server's event IDs from those of an earlier run
+
+	mu      sync.Mutex
+	latest  uint64     // the generation of the latest delta
+	deltas  []sseEvent // recent deltas, oldest first
+	clients map[*streamClient]struct{}
+}
+
+func newStreamHub(ctx context.Context, store *sdk.DynamicStore) *streamHub {
+	h := &streamHub{
+		ctx:     ctx,
+		store:   store,
+		epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		latest:  store.Snapshot().Generation(),
+		clients: make(map[*streamClient]struct{}),
+	}
+	store.Subscribe(h.changed)
+	return h
+}
+
+// id is the event ID of a generation
+func (h *streamHub) id(generation uint64) string {
+	return fmt.Sprintf("%s-%d", h.epoch, generation)
+}
+
+// resumeFrom is the generation a Last-Event-ID refers to, if it was sent by this server
+func (h *streamHub) resumeFrom(lastEventID string) (uint64, bool) {
+	epoch, generation, found := strings.Cut(lastEventID, "-")
+	if !found || epoch != h.epoch {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(generation, 10, 64)
+	return n, err == nil
+}
+
+// changed records a change to the store and sends it to every client
+func (h *streamHub) changed(evt sdk.ChangeEvent) {
+	data, err := json.Marshal(sdk.StreamEvent{Generation: evt.Generation, Flags: evt.New, Removed: evt.Removed})
+	if err != nil {
+		return
+	}
+	delta := sseEvent{name: sdk.StreamEventDelta, generation: evt.Generation, data: data}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.latest = evt.Generation
+	h.deltas = append(h.deltas, delta)
+	if len(h.deltas) > maxStreamDeltas {
+		h.deltas = h.deltas[len(h.deltas)-maxStreamDeltas:]
+	}
+	for client := range h.clients {
+		if delta.generation <= client.after {
+			continue
+		}
+		select {
+		case client.events <- delta:
+			client.after = delta.generation
+		default:
+			// Too slow: disconnect the client, which can reconnect and resume
+			delete(h.clients, client)
+			close(client.events)
+		}
+	}
+}
+
+// connect registers a client, returning the events which bring it up to date
+func (h *streamHub) connect(lastEventID string) (*streamClient, []sseEvent, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	client := &streamClient{events: make(chan sseEvent, streamClientBuffer)}
+	var initial []sseEvent
+	after, resumed := h.resumeFrom(lastEventID)
+	if resumed && after <= h.latest && (after == h.latest || (len(h.deltas) > 0 && h.deltas[0].generation <= after+1)) {
+		for _, delta := range h.deltas {
+			if delta.generation > after {
+				initial = append(initial, delta)
+			}
+		}
+		client.after = h.latest
+	} else {
+		snapshot := h.store.Snapshot()
+		data, err := json.Marshal(sdk.StreamEvent{Generation: snapshot.Generation(), Flags: snapshot.AllFlags()})
+		if err != nil {
+			return nil, nil, err
+		}
+		initial = append(initial, sseEvent{name: sdk.StreamEventSnapshot, generation: snapshot.Generation(), data: data})
+		client.after = max(snapshot.Generation(), h.latest)
+	}
+	h.clients[client] = struct{}{}
+	return client, initial, nil
+}
+
+func (h *streamHub) disconnect(client *streamClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, found := h.clients[client]; found {
+		delete(h.clients, client)
+		close(client.events)
+	}
+}
+
+// handle serves GET /api/stream
+func (h *streamHub) handle(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusNotImplemented)
+		return
+	}
+	client, initial, err := h.connect(r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer h.disconnect(client)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // stop proxies such as nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+
+	send := func(evt sseEvent) bool {
+		_, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", h.id(evt.generation), evt.name, evt.data)
+		flusher.Flush()
+		return err == nil
+	}
+	for _, evt := range initial {
+		if !send(evt) {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeatEach)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.ctx.Done():
+			return
+		case evt, open := <-client.events:
+			if !open || !send(evt) {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tommed/ducto-featureflags/sdk"
+	"github.com/tommed/ducto-featureflags/test"
+)
+
+type receivedEvent struct {
+	id, name string
+	data     sdk.StreamEvent
+}
+
+// openStream connects to the stream, returning a channel of its events which closes when the stream ends
+func openStream(t *testing.T, ctx context.Context, url, lastEventID string) <-chan receivedEvent {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := make(chan receivedEvent, 10)
+	go func() {
+		defer close(events)
+		//goland:noinspection GoUnhandledErrorResult
+		defer resp.Body.Close()
+		var evt receivedEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			field, value, _ := strings.Cut(scanner.Text(), ": ")
+			switch field {
+			case "id":
+				evt.id = value
+			case "event":
+				evt.name = value
+			case "data":
+				_ = json.Unmarshal([]byte(value), &evt.data)
+			case "":
+				events <- evt
+				evt = receivedEvent{}
+			}
+		}
+	}()
+	return events
+}
+
+func nextEvent(t *testing.T, events <-chan receivedEvent) receivedEvent {
+	t.Helper()
+	select {
+	case evt := <-events:
+		return evt
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a stream event")
+		return receivedEvent{}
+	}
+}
+
+func TestStreamHub(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	flagFile := func(variant string) string {
+		return `{ "my_flag": { "variants": ` + test.BoolVariantsJSON() + `, "defaultVariant": "` + variant + `" } }`
+	}
+	file := writeTempFlags(t, flagFile("no"))
+	store := sdk.NewDynamicStore(ctx, sdk.NewFileProvider(file))
+	require.NoError(t, store.Start())
+	defer store.Close()
+
+	hub := newStreamHub(ctx, store)
+	server := httptest.NewServer(http.HandlerFunc(hub.handle))
+	defer server.Close()
+	time.Sleep(100 * time.Millisecond) // let the watcher start
+
+	// A new client is sent every flag, then each change
+	streamCtx, closeStream := context.WithCancel(ctx)
+	events := openStream(t, streamCtx, server.URL, "")
+	snapshot := nextEvent(t, events)
+	assert.Equal(t, sdk.StreamEventSnapshot, snapshot.name)
+	assert.Equal(t, hub.id(1), snapshot.id)
+	assert.Equal(t, "no", snapshot.data.Flags["my_flag"].DefaultVariant)
+
+	require.NoError(t, os.WriteFile(file, []byte(flagFile("yes")), 0644))
+	delta := nextEvent(t, events)
+	assert.Equal(t, sdk.StreamEventDelta, delta.name)
+	assert.Equal(t, uint64(2), delta.data.Generation)
+	assert.Equal(t, "yes", delta.data.Flags["my_flag"].DefaultVariant)
+	closeStream()
+
+	// While disconnected, the flags change again
+	require.NoError(t, os.WriteFile(file, []byte(`{}`), 0644))
+	time.Sleep(300 * time.Millisecond)
+
+	// Resuming from the snapshot replays only the changes since
+	events = openStream(t, ctx, server.URL, snapshot.id)
+	delta = nextEvent(t, events)
+	assert.Equal(t, sdk.StreamEventDelta, delta.name)
+	assert.Equal(t, hub.id(2), delta.id)
+	delta = nextEvent(t, events)
+	assert.Equal(t, hub.id(3), delta.id)
+	assert.Equal(t, []string{"my_flag"}, delta.data.Removed)
+
+	// An ID from another run of the server starts again with a snapshot
+	events = openStream(t, ctx, server.URL, "other-3")
+	snapshot = nextEvent(t, events)
+	assert.Equal(t, sdk.StreamEventSnapshot, snapshot.name)
+	assert.Equal(t, uint64(3), snapshot.data.Generation)
+	assert.Empty(t, snapshot.data.Flags)
+
+	// Streams end when the server stops
+	cancel()
+	for range events {
+	}
+}
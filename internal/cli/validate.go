@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tommed/ducto-featureflags/sdk"
+)
+
+//goland:noinspection GoUnhandledErrorResult
+func Validate(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var file string
+	var warningsAsErrors bool
+	var strictFields bool
+
+	fs.StringVar(&file, "file", "flags.json", "Path to feature flag definition file")
+	fs.BoolVar(&warningsAsErrors, "warnings-as-errors", false, "Fail when there are warnings, as well as errors")
+	fs.BoolVar(&strictFields, "strict-fields", false, "Treat unknown fields as errors")
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintf(stderr, "failed to parse validate flags: %v\n", err)
+		return 1
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to read flags: %v\n", err)
+		return 1
+	}
+
+	var opts []sdk.Option
+	if strictFields {
+		opts = append(opts, sdk.WithStrictDecoding())
+	}
+	diags, err := sdk.Validate(data, sdk.DetectFormat(file), opts...)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to parse flags: %v\n", err)
+		return 1
+	}
+
+	printDiagnostics(stdout, file, diags)
+	if diags.HasErrors() || (warningsAsErrors && len(diags) > 0) {
+		return 1
+	}
+	if len(diags) == 0 {
+		fmt.Fprintf(stdout, "%s: OK\n", file)
+	}
+	return 0
+}
+
+//goland:noinspection GoUnhandledErrorResult
+func printDiagnostics(w io.Writer, file string, diags sdk.Diagnostics) {
+	for _, d := range diags {
+		fmt.Fprintf(w, "%s: %s\n", file, d)
+	}
+}
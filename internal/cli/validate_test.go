@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tommed/ducto-featureflags/test"
+)
+
+func TestValidate_Clean(t *testing.T) {
+	path := writeTempFlags(t, `{
+		"beta": { "variants": `+test.BoolVariantsJSON()+`, "defaultVariant": "yes" }
+	}`)
+
+	stdout := new(bytes.Buffer)
+	code := RunRoot([]string{"validate", "-file", path}, stdout, io.Discard)
+
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout.String(), path+": OK")
+}
+
+func TestValidate_Errors(t *testing.T) {
+	path := writeTempFlags(t, `{
+		"beta": {
+			"variants": `+test.BoolVariantsJSON()+`,
+			"defaultVariant": "maybe"
+		}
+	}`)
+
+	stdout := new(bytes.Buffer)
+	code := Validate([]string{"-file", path}, stdout, io.Discard)
+
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout.String(), path+`: line 4: error: beta.defaultVariant: variant "maybe" is not defined`)
+}
+
+func TestValidate_StrictWarnings(t *testing.T) {
+	path := writeTempFlags(t, `{
+		"beta": {
+			"variants": `+test.BoolVariantsJSON()+`,
+			"defaultVariant": "yes",
+			"rules": [
+				{ "variant": "yes" },
+				{ "variant": "no" }
+			]
+		}
+	}`)
+
+	stdout := new(bytes.Buffer)
+	assert.Equal(t, 0, Validate([]string{"-file", path}, stdout, io.Discard))
+	assert.Contains(t, stdout.String(), "warning: beta.rules[1]: rule is unreachable")
+
+	assert.Equal(t, 1, Validate([]string{"-file", path, "-warnings-as-errors"}, io.Discard, io.Discard))
+}
+
+func TestValidate_BadInput(t *testing.T) {
+	stderr := new(bytes.Buffer)
+	assert.Equal(t, 1, Validate([]string{"-file", "nonexistent.json"}, io.Discard, stderr))
+	assert.Contains(t, stderr.String(), "failed to read flags")
+
+	stderr.Reset()
+	path := writeTempFlags(t, `{ broken`)
+	assert.Equal(t, 1, Validate([]string{"-file", path}, io.Discard, stderr))
+	assert.Contains(t, stderr.String(), "failed to parse flags")
+}
+
+func TestValidate_StrictFields(t *testing.T) {
+	path := writeTempFlags(t, `{
+		"beta": { "variants": `+test.BoolVariantsJSON()+`, "defaultVariant": "yes", "seedHash": "sha256" }
+	}`)
+
+	stdout := new(bytes.Buffer)
+	assert.Equal(t, 0, Validate([]string{"-file", path}, stdout, io.Discard))
+	assert.Contains(t, stdout.String(), `warning: beta.seedHash: unknown field "seedHash"`)
+
+	stdout.Reset()
+	assert.Equal(t, 1, Validate([]string{"-file", path, "-strict-fields"}, stdout, io.Discard))
+	assert.Contains(t, stdout.String(), `error: beta.seedHash`)
+}
@@ -0,0 +1,30 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "flags.json")
+
+	require.NoError(t, WriteFileAtomic(path, []byte("one"), 0600))
+	require.NoError(t, WriteFileAtomic(path, []byte("two"), 0640))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "two", string(data))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 1, "no temporary files are left behind")
+
+	assert.Error(t, WriteFileAtomic(filepath.Join(dir, "missing", "flags.json"), []byte("x"), 0600))
+}
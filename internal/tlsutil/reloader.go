@@ -0,0 +1,244 @@
+// Package tlsutil loads the certificates used for (mutual) TLS between the serve command and the HTTP provider,
+// reloading them whenever their files change so that rotated certificates are used without a restart.
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Files are the paths of PEM encoded certificates. Any of them may be empty.
+type Files struct {
+	CertFile string // our own certificate
+	KeyFile  string // the private key of CertFile
+	CAFile   string // the certificate authorities trusted to sign the other side's certificate
+}
+
+// Empty reports whether no files are given.
+func (f Files) Empty() bool {
+	return f.CertFile == "" && f.KeyFile == "" && f.CAFile == ""
+}
+
+// Reloader holds certificates loaded from Files, checking the files each time they are used and reloading them
+// when they have changed. When a changed file cannot be loaded (e.g. it is part way through being rotated)
+// the previous certificates remain in use.
+type Reloader struct {
+	files Files
+
+	mu      sync.Mutex
+	version string
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+}
+
+// NewReloader loads the files, which must be valid.
+func NewReloader(files Files) (*Reloader, error) {
+	if (files.CertFile == "") != (files.KeyFile == "") {
+		return nil, errors.New("a certificate and its key must be given together")
+	}
+	r := &Reloader{files: files}
+	if err := r.load(r.fingerprint()); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// fingerprint identifies the current version of the files, following symlinks as Kubernetes secrets use them
+func (r *Reloader) fingerprint() string {
+	var parts []string
+	for _, path := range []string{r.files.CertFile, r.files.KeyFile, r.files.CAFile} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			parts = append(parts, fmt.Sprintf("%s:%d:%d", path, info.Size(), info.ModTime().UnixNano()))
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+func (r *Reloader) load(version string) error {
+	var cert *tls.Certificate
+	if r.files.CertFile != "" {
+		pair, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+		if err != nil {
+			return fmt.Errorf("load certificate: %w", err)
+		}
+		cert = &pair
+	}
+
+	var pool *x509.CertPool
+	if r.files.CAFile != "" {
+		data, err := os.ReadFile(r.files.CAFile)
+		if err != nil {
+			return fmt.Errorf("load CA: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("load CA: no certificates found in %s", r.files.CAFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.version, r.cert, r.pool = version, cert, pool
+	return nil
+}
+
+// current returns the certificates, reloading them first if the files have changed
+func (r *Reloader) current() (*tls.Certificate, *x509.CertPool) {
+	version := r.fingerprint()
+	r.mu.Lock()
+	changed := version != r.version
+	r.mu.Unlock()
+	if changed {
+		_ = r.load(version)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert, r.pool
+}
+
+// ServerConfig is the configuration for a TLS server using the certificate, which is required. When a CA is
+// given, clients presenting a certificate must have one signed by it, and requireClientCert makes one mandatory.
+func (r *Reloader) ServerConfig(requireClientCert bool) (*tls.Config, error) {
+	if r.files.CertFile == "" {
+		return nil, errors.New("a server certificate and key are required for TLS")
+	}
+	if requireClientCert && r.files.CAFile == "" {
+		return nil, errors.New("a client CA is required to verify client certificates")
+	}
+
+	auth := tls.NoClientCert
+	switch {
+	case requireClientCert:
+		auth = tls.RequireAndVerifyClientCert
+	case r.files.CAFile != "":
+		auth = tls.VerifyClientCertIfGiven
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := r.current()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientCAs:    pool,
+				ClientAuth:   auth,
+			}, nil
+		},
+	}, nil
+}
+
+// ClientConfig is the configuration for a TLS client: a copy of base (which may be nil) which presents the
+// certificate (if any) and trusts the CA (if given) instead of the system's certificate authorities. Both are
+// read as each connection is made, so new connections always use the latest certificates, whether made
+// directly or through a proxy. With a CA, the server's certificate is checked against the ServerName of base,
+// or when that is empty the name sent to the server, which is never an IP address; Transport sets ServerName
+// for each host.
+func (r *Reloader) ClientConfig(base *tls.Config) *tls.Config {
+	config := &tls.Config{}
+	if base != nil {
+		config = base.Clone()
+	}
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	if r.files.CertFile != "" {
+		config.Certificates = nil
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		}
+	}
+	if r.files.CAFile != "" && !config.InsecureSkipVerify {
+		// RootCAs cannot change once the config is in use, so the server's certificate is verified here instead
+		config.InsecureSkipVerify = true
+		next, serverName := config.VerifyConnection, config.ServerName
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if err := r.verifyServer(state, serverName); err != nil {
+				return err
+			}
+			if next != nil {
+				return next(state)
+			}
+			return nil
+		}
+	}
+	return config
+}
+
+// verifyServer checks the server's certificate is for the server name and signed by the CA, as the TLS client
+// would have done itself
+func (r *Reloader) verifyServer(state tls.ConnectionState, serverName string) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("tls: the server sent no certificate")
+	}
+	if serverName == "" {
+		serverName = state.ServerName
+	}
+	if serverName == "" {
+		return errors.New("tls: no server name to verify the server's certificate against")
+	}
+	_, pool := r.current()
+	opts := x509.VerifyOptions{DNSName: serverName, Roots: pool, Intermediates: x509.NewCertPool()}
+	for _, cert := range state.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// Transport is a copy of base which uses ClientConfig for each host it connects to, with the ServerName of
+// the host, so that the server's certificate is verified against the host even when it is an IP address.
+func (r *Reloader) Transport(base *http.Transport) http.RoundTripper {
+	return &hostTransport{reloader: r, base: base.Clone(), hosts: map[string]*http.Transport{}}
+}
+
+// hostTransport sends each request through a transport configured for the request's host
+type hostTransport struct {
+	reloader *Reloader
+	base     *http.Transport
+	mu       sync.Mutex
+	hosts    map[string]*http.Transport
+}
+
+func (t *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.transport(req.URL.Hostname()).RoundTrip(req)
+}
+
+// transport is the transport for host, made the first time it is needed so its connections are reused
+func (t *hostTransport) transport(host string) *http.Transport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if transport, ok := t.hosts[host]; ok {
+		return transport
+	}
+	transport := t.base.Clone()
+	config := &tls.Config{}
+	if transport.TLSClientConfig != nil {
+		config = transport.TLSClientConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+	transport.TLSClientConfig = t.reloader.ClientConfig(config)
+	t.hosts[host] = transport
+	return transport
+}
+
+// CloseIdleConnections closes the idle connections of every host, so http.Client.CloseIdleConnections works.
+func (t *hostTransport) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, transport := range t.hosts {
+		transport.CloseIdleConnections()
+	}
+}
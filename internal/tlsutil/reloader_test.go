@@ -0,0 +1,166 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tommed/ducto-featureflags/test"
+)
+
+// newServer starts an HTTPS server using the reloader
+func newServer(t *testing.T, reloader *Reloader, requireClientCert bool) *httptest.Server {
+	t.Helper()
+	config, err := reloader.ServerConfig(requireClientCert)
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	server.TLS = config
+	server.Config.ErrorLog = log.New(io.Discard, "", 0) // rejected handshakes are expected
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// get makes a request on a new connection, so the latest client certificates are used
+func get(reloader *Reloader, url string) error {
+	client := &http.Client{Transport: reloader.Transport(&http.Transport{DisableKeepAlives: true})}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func TestNewReloader_Errors(t *testing.T) {
+	dir := t.TempDir()
+	ca := test.NewCA(t, "ca")
+	certFile, keyFile := ca.WriteCert(t, dir, "server")
+	empty := filepath.Join(dir, "empty.pem")
+	require.NoError(t, os.WriteFile(empty, nil, 0600))
+
+	tests := []struct {
+		name  string
+		files Files
+		err   string
+	}{
+		{"cert without key", Files{CertFile: certFile}, "must be given together"},
+		{"missing cert", Files{CertFile: filepath.Join(dir, "missing.crt"), KeyFile: keyFile}, "load certificate"},
+		{"missing CA", Files{CAFile: filepath.Join(dir, "missing.pem")}, "load CA"},
+		{"empty CA", Files{CAFile: empty}, "no certificates found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewReloader(tt.files)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+
+	reloader, err := NewReloader(Files{CAFile: certFile})
+	require.NoError(t, err)
+	_, err = reloader.ServerConfig(false)
+	assert.ErrorContains(t, err, "server certificate and key are required")
+
+	reloader, err = NewReloader(Files{CertFile: certFile, KeyFile: keyFile})
+	require.NoError(t, err)
+	_, err = reloader.ServerConfig(true)
+	assert.ErrorContains(t, err, "client CA is required")
+}
+
+func TestReloader_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := test.NewCA(t, "ca")
+	caFile := filepath.Join(dir, "ca.pem")
+	ca.WriteCA(t, caFile)
+	serverCert, serverKey := ca.WriteCert(t, dir, "server")
+	clientCert, clientKey := ca.WriteCert(t, dir, "client")
+
+	serverReloader, err := NewReloader(Files{CertFile: serverCert, KeyFile: serverKey, CAFile: caFile})
+	require.NoError(t, err)
+	server := newServer(t, serverReloader, true)
+
+	client, err := NewReloader(Files{CertFile: clientCert, KeyFile: clientKey, CAFile: caFile})
+	require.NoError(t, err)
+	assert.NoError(t, get(client, server.URL))
+
+	// Without a client certificate the server refuses the connection
+	anonymous, err := NewReloader(Files{CAFile: caFile})
+	require.NoError(t, err)
+	assert.Error(t, get(anonymous, server.URL))
+
+	// ...unless client certificates are optional
+	optional := newServer(t, serverReloader, false)
+	assert.NoError(t, get(anonymous, optional.URL))
+	assert.NoError(t, get(client, optional.URL))
+}
+
+func TestReloader_VerifiesServerName(t *testing.T) {
+	dir := t.TempDir()
+	ca := test.NewCA(t, "ca")
+	caFile := filepath.Join(dir, "ca.pem")
+	ca.WriteCA(t, caFile)
+	serverCert, serverKey := ca.WriteCertFor(t, dir, "server", "flags.example.com", "10.0.0.1")
+
+	serverReloader, err := NewReloader(Files{CertFile: serverCert, KeyFile: serverKey})
+	require.NoError(t, err)
+	server := newServer(t, serverReloader, false)
+	client, err := NewReloader(Files{CAFile: caFile})
+	require.NoError(t, err)
+
+	// The certificate is signed by the CA, but is not for the address dialled, which sends no name to the server
+	err = get(client, server.URL)
+	assert.ErrorContains(t, err, "127.0.0.1")
+	assert.ErrorContains(t, err, "certificate is valid for")
+
+	// ...nor for localhost, which does
+	err = get(client, strings.Replace(server.URL, "127.0.0.1", "localhost", 1))
+	assert.ErrorContains(t, err, "not localhost")
+
+	// Without a name, there is nothing to check the certificate against
+	plain := &http.Client{Transport: &http.Transport{TLSClientConfig: client.ClientConfig(nil)}}
+	_, err = plain.Get(server.URL)
+	assert.ErrorContains(t, err, "no server name")
+
+	// ...but one given is used
+	named := &http.Client{Transport: &http.Transport{TLSClientConfig: client.ClientConfig(&tls.Config{ServerName: "flags.example.com"})}}
+	resp, err := named.Get(server.URL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+}
+
+func TestReloader_ReloadsRotatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	ca := test.NewCA(t, "old")
+	caFile := filepath.Join(dir, "ca.pem")
+	ca.WriteCA(t, caFile)
+	serverCert, serverKey := ca.WriteCert(t, dir, "server")
+
+	serverReloader, err := NewReloader(Files{CertFile: serverCert, KeyFile: serverKey})
+	require.NoError(t, err)
+	server := newServer(t, serverReloader, false)
+	client, err := NewReloader(Files{CAFile: caFile})
+	require.NoError(t, err)
+	require.NoError(t, get(client, server.URL))
+
+	// The server's certificate is rotated to one from a new CA, which the client does not trust yet
+	rotated := test.NewCA(t, "new")
+	rotated.WriteCert(t, dir, "server")
+	assert.Error(t, get(client, server.URL))
+
+	// Then the client's CA file is rotated too
+	rotated.WriteCA(t, caFile)
+	assert.NoError(t, get(client, server.URL))
+
+	// A broken file keeps the previous certificates in use
+	require.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0600))
+	assert.NoError(t, get(client, server.URL))
+}
@@ -12,7 +12,6 @@ func ExampleDuctoProvider() {
 	// Create the flag store (e.g., from a static file or dynamic source)
 	store, _ := sdk.NewStoreFromBytesWithFormat([]byte(`{
 		"my_flag": {
-			"enabled": true,
 			"defaultVariant": "on",
 			"variants": {
 				"on": "hello world"
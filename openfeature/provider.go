@@ -1,13 +1,27 @@
 package openfeature
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/open-feature/go-sdk/openfeature"
 	"github.com/tommed/ducto-featureflags/sdk"
 )
 
-// DuctoProvider implements the OpenFeature Provider interface
+// eventBuffer is how many events are queued for OpenFeature before the store's subscriptions wait for it
+const eventBuffer = 16
+
+// DuctoProvider implements the OpenFeature Provider interface.
+// For stores which change, like sdk.DynamicStore, it also implements StateHandler and EventHandler: Init starts
+// the store, and OpenFeature is told when the flags change and when they go STALE or fail to load.
 type DuctoProvider struct {
 	Store sdk.AnyStore // your existing flag store (interface)
+
+	mu          sync.Mutex
+	events      chan openfeature.Event
+	done        chan struct{} // closed by Shutdown, nil until Init subscribes to the store
+	unsubscribe []func()
+	started     bool // Init started the store, so Shutdown stops it
 }
 
 func NewProvider(store sdk.AnyStore) openfeature.FeatureProvider {
@@ -21,3 +35,148 @@ func (p *DuctoProvider) Metadata() openfeature.Metadata {
 func (p *DuctoProvider) Hooks() []openfeature.Hook {
 	return nil
 }
+
+// healthReporter is implemented by stores which report their health, like sdk.DynamicStore
+type healthReporter interface {
+	Status() sdk.Status
+}
+
+// dynamicStore is implemented by stores which can be started and report their changes, like sdk.DynamicStore
+type dynamicStore interface {
+	healthReporter
+	Start() error
+	Stop()
+	Running() bool
+	Subscribe(fn func(sdk.ChangeEvent)) (unsubscribe func())
+	SubscribeStatus(fn func(sdk.Status)) (unsubscribe func())
+}
+
+// Status reports the OpenFeature state of the provider, taken from the store when it reports its health.
+// Other stores never change, so are always ready.
+func (p *DuctoProvider) Status() openfeature.State {
+	h, ok := p.Store.(healthReporter)
+	if !ok {
+		return openfeature.ReadyState
+	}
+	// sdk.State uses the OpenFeature names
+	return openfeature.State(h.Status().State)
+}
+
+// Init starts the store unless it is already running, and sends OpenFeature an event for each change to the
+// flags or to the store's state from then on. An error loading the flags puts the provider in the ERROR state.
+func (p *DuctoProvider) Init(openfeature.EvaluationContext) error {
+	store, ok := p.Store.(dynamicStore)
+	if !ok {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done != nil {
+		return nil // already initialised, for another domain
+	}
+
+	// Subscribe first, so no change is missed while starting
+	events, done := p.eventChannel(), make(chan struct{})
+	emit := func(evt openfeature.Event) {
+		select {
+		case events <- evt:
+		case <-done:
+		}
+	}
+	p.done = done
+	p.unsubscribe = []func(){
+		store.SubscribeStatus(func(status sdk.Status) {
+			if evt, ok := p.statusEvent(status); ok {
+				emit(evt)
+			}
+		}),
+		store.Subscribe(func(change sdk.ChangeEvent) {
+			if change.Generation <= 1 {
+				return // the first load, which is reported by Init succeeding
+			}
+			emit(openfeature.Event{
+				ProviderName: p.Metadata().Name,
+				EventType:    openfeature.ProviderConfigChange,
+				ProviderEventDetails: openfeature.ProviderEventDetails{
+					Message:     "flags changed",
+					FlagChanges: append(append(append([]string{}, change.Added...), change.Modified...), change.Removed...),
+				},
+			})
+			// OpenFeature takes a change to mean the provider is ready, which it may not be
+			if evt, ok := p.statusEvent(store.Status()); ok && evt.EventType != openfeature.ProviderReady {
+				emit(evt)
+			}
+		}),
+	}
+
+	if !store.Running() {
+		if err := store.Start(); err != nil {
+			p.shutdown()
+			return fmt.Errorf("load flags: %w", err)
+		}
+		p.started = true
+	}
+	// The flags may already be stale, for instance when loaded from a cache, but Init succeeding means READY
+	if evt, ok := p.statusEvent(store.Status()); ok && evt.EventType != openfeature.ProviderReady {
+		emit(evt)
+	}
+	return nil
+}
+
+// Shutdown ends the events, and stops the store if Init started it.
+func (p *DuctoProvider) Shutdown() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.shutdown()
+}
+
+// shutdown ends the subscriptions made by Init. The lock must be held.
+func (p *DuctoProvider) shutdown() {
+	if p.done == nil {
+		return
+	}
+	for _, unsubscribe := range p.unsubscribe {
+		unsubscribe()
+	}
+	close(p.done)
+	if p.started {
+		p.Store.(dynamicStore).Stop()
+	}
+	p.done, p.unsubscribe, p.started = nil, nil, false
+}
+
+// EventChannel is the channel of events OpenFeature listens to. Only stores which change send any.
+func (p *DuctoProvider) EventChannel() <-chan openfeature.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.eventChannel()
+}
+
+// eventChannel creates the channel of events the first time it is needed. The lock must be held.
+func (p *DuctoProvider) eventChannel() chan openfeature.Event {
+	if p.events == nil {
+		p.events = make(chan openfeature.Event, eventBuffer)
+	}
+	return p.events
+}
+
+// statusEvent is the event which tells OpenFeature about the state of the store
+func (p *DuctoProvider) statusEvent(status sdk.Status) (openfeature.Event, bool) {
+	evt := openfeature.Event{ProviderName: p.Metadata().Name}
+	switch status.State {
+	case sdk.StateReady:
+		evt.EventType = openfeature.ProviderReady
+	case sdk.StateStale:
+		evt.EventType = openfeature.ProviderStale
+	case sdk.StateError:
+		evt.EventType = openfeature.ProviderError
+		evt.ErrorCode = openfeature.GeneralCode
+	default:
+		return evt, false
+	}
+	evt.Message = fmt.Sprintf("flags are %s", status.State)
+	if status.State != sdk.StateReady && status.LastError != nil {
+		evt.Message += ": " + status.LastError.Error()
+	}
+	return evt, true
+}
@@ -0,0 +1,57 @@
+package openfeature
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/tommed/ducto-featureflags/sdk"
+)
+
+// flagMetadata converts the descriptive fields of a flag into OpenFeature flag metadata.
+// OpenFeature only allows bool, string, int64 and float64 values, so anything else is flattened.
+func flagMetadata(f sdk.Flag) openfeature.FlagMetadata {
+	result := openfeature.FlagMetadata{}
+	for k, v := range f.Metadata {
+		result[k] = metadataValue(v)
+	}
+	if f.Description != "" {
+		result["description"] = f.Description
+	}
+	if f.Owner != "" {
+		result["owner"] = f.Owner
+	}
+	if len(f.Tags) > 0 {
+		result["tags"] = strings.Join(f.Tags, ",")
+	}
+	if f.CreatedAt != nil {
+		result["createdAt"] = f.CreatedAt.Format(time.RFC3339)
+	}
+	if f.ExpiresAt != nil {
+		result["expiresAt"] = f.ExpiresAt.Format(time.RFC3339)
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+func metadataValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case bool, string, int64, float64:
+		return t
+	case int:
+		return int64(t)
+	case float32:
+		return float64(t)
+	case time.Time:
+		return t.Format(time.RFC3339)
+	default:
+		data, err := json.Marshal(t)
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+}
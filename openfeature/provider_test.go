@@ -4,7 +4,11 @@ import (
 	"context"
 	"github.com/open-feature/go-sdk/openfeature"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/tommed/ducto-featureflags/sdk"
+	"github.com/tommed/ducto-featureflags/test"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -160,3 +164,105 @@ func TestObjectEvaluation(t *testing.T) {
 	}, detail.Value)
 	assert.Equal(t, openfeature.TargetingMatchReason, detail.Reason)
 }
+
+func TestFlagMetadataEvaluation(t *testing.T) {
+	provider := makeTestProvider(`{
+		"dark_mode": {
+			"defaultVariant": "off",
+			"variants": { "on": true, "off": false },
+			"description": "Dark colour scheme",
+			"owner": "team-web",
+			"tags": ["ui", "theme"],
+			"expiresAt": "2030-01-01T00:00:00Z",
+			"metadata": { "ticket": "WEB-1", "priority": 2, "links": ["a", "b"] }
+		},
+		"plain": {
+			"defaultVariant": "off",
+			"variants": { "on": true, "off": false }
+		}
+	}`)
+
+	detail := provider.BooleanEvaluation(context.Background(), "dark_mode", true, nil)
+	assert.Equal(t, false, detail.Value)
+	assert.Equal(t, openfeature.FlagMetadata{
+		"description": "Dark colour scheme",
+		"owner":       "team-web",
+		"tags":        "ui,theme",
+		"expiresAt":   "2030-01-01T00:00:00Z",
+		"ticket":      "WEB-1",
+		"priority":    float64(2),
+		"links":       `["a","b"]`,
+	}, detail.FlagMetadata)
+
+	// Metadata is attached even when the requested type does not match
+	strDetail := provider.StringEvaluation(context.Background(), "dark_mode", "x", nil)
+	assert.NotNil(t, strDetail.ResolutionError)
+	assert.Equal(t, "team-web", strDetail.FlagMetadata["owner"])
+
+	plain := provider.BooleanEvaluation(context.Background(), "plain", true, nil)
+	assert.Nil(t, plain.FlagMetadata)
+}
+
+func TestProviderStatus(t *testing.T) {
+	static := &DuctoProvider{Store: sdk.NewStore(map[string]sdk.Flag{})}
+	assert.Equal(t, openfeature.ReadyState, static.Status())
+
+	dynamic := sdk.NewDynamicStore(context.Background(), sdk.NewFileProvider("nonexistent.json"))
+	provider := &DuctoProvider{Store: dynamic}
+	assert.Equal(t, openfeature.NotReadyState, provider.Status())
+
+	assert.Error(t, dynamic.Start())
+	assert.Equal(t, openfeature.ErrorState, provider.Status())
+}
+
+func TestProviderEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	file := filepath.Join(t.TempDir(), "flags.json")
+	flagFile := func(variant string) string {
+		return `{ "my_flag": { "variants": ` + test.BoolVariantsJSON() + `, "defaultVariant": "` + variant + `" } }`
+	}
+	require.NoError(t, os.WriteFile(file, []byte(flagFile("no")), 0644))
+	store := sdk.NewDynamicStore(ctx, sdk.NewFileProvider(file))
+	defer store.Close()
+
+	// Setting the provider starts the store
+	require.NoError(t, openfeature.SetProviderAndWait(NewProvider(store)))
+	client := openfeature.NewClient("events")
+	assert.True(t, store.Running())
+	assert.Equal(t, openfeature.ReadyState, client.State())
+
+	changes := make(chan []string, 10)
+	onChange := func(details openfeature.EventDetails) { changes <- details.FlagChanges }
+	client.AddHandler(openfeature.ProviderConfigChange, &onChange)
+
+	time.Sleep(100 * time.Millisecond) // let the watcher start
+	// A rejected reload leaves the flags stale, until they are fixed
+	require.NoError(t, os.WriteFile(file, []byte(`{ "my_flag": { "defaultVariant": "missing" } }`), 0644))
+	assert.Eventually(t, func() bool { return client.State() == openfeature.StaleState }, 2*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(file, []byte(flagFile("yes")), 0644))
+	assert.Eventually(t, func() bool { return client.State() == openfeature.ReadyState }, 2*time.Second, 10*time.Millisecond)
+	select {
+	case flags := <-changes:
+		assert.Equal(t, []string{"my_flag"}, flags)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for PROVIDER_CONFIGURATION_CHANGED")
+	}
+	val, err := client.BooleanValue(ctx, "my_flag", false, openfeature.EvaluationContext{})
+	assert.NoError(t, err)
+	assert.True(t, val)
+
+	// Replacing the provider stops the store it started
+	require.NoError(t, openfeature.SetProviderAndWait(openfeature.NoopProvider{}))
+	assert.Eventually(t, func() bool { return !store.Running() }, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestProviderEvents_InitError(t *testing.T) {
+	store := sdk.NewDynamicStore(context.Background(), sdk.NewFileProvider("nonexistent.json"))
+	defer store.Close()
+
+	assert.Error(t, openfeature.SetProviderAndWait(NewProvider(store)))
+	assert.Equal(t, openfeature.ErrorState, openfeature.NewClient("init-error").State())
+}
@@ -23,12 +23,14 @@ func (p *DuctoProvider) BooleanEvaluation(
 	}
 
 	internalCtx := convertFlattenedContext(evalCtx)
+	metadata := flagMetadata(flagDef)
 	result := flagDef.Evaluate(internalCtx)
 	if !result.OK {
 		return openfeature.BoolResolutionDetail{
 			Value: defaultValue,
 			ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
 				Variant:         result.Variant,
+				FlagMetadata:    metadata,
 				Reason:          openfeature.DefaultReason,
 				ResolutionError: openfeature.NewParseErrorResolutionError("variant not found"),
 			},
@@ -41,6 +43,7 @@ func (p *DuctoProvider) BooleanEvaluation(
 			Value: defaultValue,
 			ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
 				Variant:         result.Variant,
+				FlagMetadata:    metadata,
 				Reason:          openfeature.DefaultReason,
 				ResolutionError: openfeature.NewTypeMismatchResolutionError("bool"),
 			},
@@ -55,8 +58,9 @@ func (p *DuctoProvider) BooleanEvaluation(
 	return openfeature.BoolResolutionDetail{
 		Value: b,
 		ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
-			Variant: result.Variant,
-			Reason:  reason,
+			Variant:      result.Variant,
+			Reason:       reason,
+			FlagMetadata: metadata,
 		},
 	}
 }
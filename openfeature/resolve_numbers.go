@@ -23,12 +23,14 @@ func (p *DuctoProvider) IntEvaluation(
 	}
 
 	internalCtx := convertFlattenedContext(evalCtx)
+	metadata := flagMetadata(flagDef)
 	result := flagDef.Evaluate(internalCtx)
 	if !result.OK {
 		return openfeature.IntResolutionDetail{
 			Value: defaultValue,
 			ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
 				Variant:         result.Variant,
+				FlagMetadata:    metadata,
 				Reason:          openfeature.DefaultReason,
 				ResolutionError: openfeature.NewParseErrorResolutionError("variant not found"),
 			},
@@ -48,6 +50,7 @@ func (p *DuctoProvider) IntEvaluation(
 			Value: defaultValue,
 			ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
 				Variant:         result.Variant,
+				FlagMetadata:    metadata,
 				Reason:          openfeature.DefaultReason,
 				ResolutionError: openfeature.NewTypeMismatchResolutionError("int"),
 			},
@@ -62,8 +65,9 @@ func (p *DuctoProvider) IntEvaluation(
 	return openfeature.IntResolutionDetail{
 		Value: n,
 		ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
-			Variant: result.Variant,
-			Reason:  reason,
+			Variant:      result.Variant,
+			Reason:       reason,
+			FlagMetadata: metadata,
 		},
 	}
 }
@@ -86,12 +90,14 @@ func (p *DuctoProvider) FloatEvaluation(
 	}
 
 	internalCtx := convertFlattenedContext(evalCtx)
+	metadata := flagMetadata(flagDef)
 	result := flagDef.Evaluate(internalCtx)
 	if !result.OK {
 		return openfeature.FloatResolutionDetail{
 			Value: defaultValue,
 			ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
 				Variant:         result.Variant,
+				FlagMetadata:    metadata,
 				Reason:          openfeature.DefaultReason,
 				ResolutionError: openfeature.NewParseErrorResolutionError("variant not found"),
 			},
@@ -113,6 +119,7 @@ func (p *DuctoProvider) FloatEvaluation(
 			Value: defaultValue,
 			ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
 				Variant:         result.Variant,
+				FlagMetadata:    metadata,
 				Reason:          openfeature.DefaultReason,
 				ResolutionError: openfeature.NewTypeMismatchResolutionError("float"),
 			},
@@ -127,8 +134,9 @@ func (p *DuctoProvider) FloatEvaluation(
 	return openfeature.FloatResolutionDetail{
 		Value: f,
 		ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
-			Variant: result.Variant,
-			Reason:  reason,
+			Variant:      result.Variant,
+			Reason:       reason,
+			FlagMetadata: metadata,
 		},
 	}
 }
@@ -23,12 +23,14 @@ func (p *DuctoProvider) ObjectEvaluation(
 	}
 
 	internalCtx := convertFlattenedContext(evalCtx)
+	metadata := flagMetadata(flagDef)
 	result := flagDef.Evaluate(internalCtx)
 	if !result.OK {
 		return openfeature.InterfaceResolutionDetail{
 			Value: defaultValue,
 			ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
 				Variant:         result.Variant,
+				FlagMetadata:    metadata,
 				Reason:          openfeature.DefaultReason,
 				ResolutionError: openfeature.NewParseErrorResolutionError("variant not found"),
 			},
@@ -43,8 +45,9 @@ func (p *DuctoProvider) ObjectEvaluation(
 	return openfeature.InterfaceResolutionDetail{
 		Value: result.Value,
 		ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
-			Variant: result.Variant,
-			Reason:  reason,
+			Variant:      result.Variant,
+			Reason:       reason,
+			FlagMetadata: metadata,
 		},
 	}
 }
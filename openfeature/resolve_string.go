@@ -23,12 +23,14 @@ func (p *DuctoProvider) StringEvaluation(
 	}
 
 	internalCtx := convertFlattenedContext(evalCtx)
+	metadata := flagMetadata(flagDef)
 	result := flagDef.Evaluate(internalCtx)
 	if !result.OK {
 		return openfeature.StringResolutionDetail{
 			Value: defaultValue,
 			ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
 				Variant:         result.Variant,
+				FlagMetadata:    metadata,
 				Reason:          openfeature.DefaultReason,
 				ResolutionError: openfeature.NewParseErrorResolutionError("variant not found"),
 			},
@@ -41,6 +43,7 @@ func (p *DuctoProvider) StringEvaluation(
 			Value: defaultValue,
 			ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
 				Variant:         result.Variant,
+				FlagMetadata:    metadata,
 				Reason:          openfeature.DefaultReason,
 				ResolutionError: openfeature.NewTypeMismatchResolutionError("string"),
 			},
@@ -55,8 +58,9 @@ func (p *DuctoProvider) StringEvaluation(
 	return openfeature.StringResolutionDetail{
 		Value: s,
 		ProviderResolutionDetail: openfeature.ProviderResolutionDetail{
-			Variant: result.Variant,
-			Reason:  reason,
+			Variant:      result.Variant,
+			Reason:       reason,
+			FlagMetadata: metadata,
 		},
 	}
 }
@@ -0,0 +1,175 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tommed/ducto-featureflags/internal/fsutil"
+)
+
+// Origin records where the flags served by a CachingProvider came from.
+type Origin string
+
+const (
+	OriginNone     Origin = ""         // nothing has been loaded yet
+	OriginSource   Origin = "source"   // loaded from the wrapped provider
+	OriginCache    Origin = "cache"    // the last known good flags, from the cache file
+	OriginDefaults Origin = "defaults" // the defaults given by WithDefaultFlags
+)
+
+// errNotCached is the status error when flags from the source were not saved to the cache
+var errNotCached = errors.New("save cache: the flags have validation errors, so the previous cache was kept")
+
+// cachedAtKey is the document metadata field recording when cached flags were loaded from the source
+const cachedAtKey = "cachedAt"
+
+// CacheStatus describes the flags most recently served by a CachingProvider.
+type CacheStatus struct {
+	Origin    Origin
+	FetchedAt time.Time // when the flags were loaded from the source; zero for defaults
+	Err       error     // the most recent error from the source or from saving the cache, if any
+}
+
+// Stale reports whether the flags did not come from the source, so may be out of date.
+func (s CacheStatus) Stale() bool {
+	return s.Origin != OriginSource
+}
+
+// CachingProvider is a StoreProvider which saves every store loaded by another provider to a cache file.
+// When the source cannot be loaded it serves the last known good flags from the cache instead, or
+// failing that the defaults given by WithDefaultFlags, so that a service can still start while offline.
+type CachingProvider struct {
+	source    StoreProvider
+	cachePath string
+	opts      []Option
+
+	mu     sync.RWMutex
+	status CacheStatus
+}
+
+// NewCachingProvider wraps source, keeping the last known good flags in the file at cachePath.
+// The options are used to load the cache and defaults, so should match those given to the source.
+func NewCachingProvider(source StoreProvider, cachePath string, opts ...Option) *CachingProvider {
+	return &CachingProvider{source: source, cachePath: cachePath, opts: opts}
+}
+
+// Status reports where the current flags came from and how old they are.
+func (c *CachingProvider) Status() CacheStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.status
+}
+
+// Load loads from the source, falling back to the cache and then the defaults.
+// An error is only returned when none of them could be loaded.
+func (c *CachingProvider) Load(ctx context.Context) (*Store, error) {
+	store, err := c.source.Load(ctx)
+	if err == nil && store != nil {
+		c.fromSource(store)
+		return store, nil
+	}
+	if err == nil {
+		err = errors.New("source returned no flags")
+	}
+	sourceErr := fmt.Errorf("load source: %w", err)
+
+	store, fetchedAt, cacheErr := c.loadCache()
+	if cacheErr == nil {
+		c.setStatus(CacheStatus{Origin: OriginCache, FetchedAt: fetchedAt, Err: sourceErr})
+		return store, nil
+	}
+
+	o := newOptions(c.opts)
+	if o.defaults == nil {
+		return nil, errors.Join(sourceErr, cacheErr)
+	}
+	store, err = NewStoreFromBytesWithFormat(o.defaults, o.defaultsFormat, c.opts...)
+	if err != nil {
+		return nil, errors.Join(sourceErr, cacheErr, fmt.Errorf("load defaults: %w", err))
+	}
+	c.setStatus(CacheStatus{Origin: OriginDefaults, Err: sourceErr})
+	return store, nil
+}
+
+// Watch passes on every update from the source, saving each one to the cache.
+func (c *CachingProvider) Watch(ctx context.Context, onChange func(*Store)) {
+	c.source.Watch(ctx, func(store *Store) {
+		if store == nil {
+			return
+		}
+		c.fromSource(store)
+		onChange(store)
+	})
+}
+
+// Observe passes the observer on to the source, if it reports the outcome of its reloads.
+func (c *CachingProvider) Observe(observer ProviderObserver) {
+	if observable, ok := c.source.(ObservableProvider); ok {
+		observable.Observe(observer)
+	}
+}
+
+// fromSource records flags loaded from the source, saving them to the cache unless they have validation errors.
+// A DynamicStore rejects such a reload, so saving it would replace the last known good flags with bad ones.
+func (c *CachingProvider) fromSource(store *Store) {
+	now := time.Now()
+	if store.Diagnostics().HasErrors() {
+		c.setStatus(CacheStatus{Origin: OriginSource, FetchedAt: now, Err: errNotCached})
+		return
+	}
+	c.setStatus(CacheStatus{Origin: OriginSource, FetchedAt: now, Err: c.saveCache(store, now)})
+}
+
+func (c *CachingProvider) setStatus(status CacheStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status = status
+}
+
+// saveCache writes the store as a flag file, so the cache can also be inspected with the CLI.
+// The flags are saved as loaded, with environment overrides and segments already resolved.
+func (c *CachingProvider) saveCache(store *Store, fetchedAt time.Time) error {
+	flags := store.flags
+	if flags == nil {
+		flags = map[string]Flag{}
+	}
+	doc := Document{
+		SchemaVersion: CurrentSchemaVersion,
+		Flags:         flags,
+		Metadata:      map[string]interface{}{cachedAtKey: fetchedAt.UTC().Format(time.RFC3339Nano)},
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("save cache: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(c.cachePath, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("save cache: %w", err)
+	}
+	return nil
+}
+
+func (c *CachingProvider) loadCache() (*Store, time.Time, error) {
+	data, err := os.ReadFile(c.cachePath)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("load cache: %w", err)
+	}
+	doc, err := ParseDocument(data, "json")
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("load cache: %w", err)
+	}
+	store, err := newStoreFromDocument(doc, newOptions(c.opts))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("load cache: %w", err)
+	}
+
+	var fetchedAt time.Time
+	if s, ok := doc.Metadata[cachedAtKey].(string); ok {
+		fetchedAt, _ = time.Parse(time.RFC3339Nano, s)
+	}
+	return store, fetchedAt, nil
+}
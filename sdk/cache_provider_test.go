@@ -0,0 +1,143 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tommed/ducto-featureflags/test"
+)
+
+// failingProvider is a StoreProvider which can never be reached
+type failingProvider struct{}
+
+func (failingProvider) Load(_ context.Context) (*Store, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (failingProvider) Watch(ctx context.Context, _ func(*Store)) {
+	<-ctx.Done()
+}
+
+func TestCachingProvider_SavesAndFallsBackToCache(t *testing.T) {
+	cache := filepath.Join(t.TempDir(), "flags.cache.json")
+
+	// Online: the flags are loaded from the source and saved
+	online := NewCachingProvider(newChanProvider(map[string]Flag{"a": boolFlag("yes")}), cache)
+	assert.Equal(t, OriginNone, online.Status().Origin)
+	store, err := online.Load(context.Background())
+	require.NoError(t, err)
+	status := online.Status()
+	assert.Equal(t, OriginSource, status.Origin)
+	assert.False(t, status.Stale())
+	assert.NoError(t, status.Err)
+	assert.WithinDuration(t, time.Now(), status.FetchedAt, time.Second)
+	assert.Len(t, store.AllFlags(), 1)
+
+	// The cache is itself a valid flag file
+	_, err = NewStoreFromFile(cache, WithStrictValidation(), WithStrictDecoding())
+	assert.NoError(t, err)
+
+	// Offline: the last known good flags are served from the cache
+	offline := NewCachingProvider(failingProvider{}, cache)
+	store, err = offline.Load(context.Background())
+	require.NoError(t, err)
+	f, ok := store.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, true, f.Evaluate(nil).Value)
+
+	cached := offline.Status()
+	assert.Equal(t, OriginCache, cached.Origin)
+	assert.True(t, cached.Stale())
+	assert.ErrorContains(t, cached.Err, "connection refused")
+	assert.WithinDuration(t, status.FetchedAt, cached.FetchedAt, 0)
+}
+
+func TestCachingProvider_FallsBackToDefaults(t *testing.T) {
+	cache := filepath.Join(t.TempDir(), "missing.json")
+	defaults := []byte(`{ "a": { "variants": ` + test.BoolVariantsJSON() + `, "defaultVariant": "no" } }`)
+
+	provider := NewCachingProvider(failingProvider{}, cache, WithDefaultFlags(defaults, "json"))
+	store, err := provider.Load(context.Background())
+	require.NoError(t, err)
+	f, ok := store.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "no", f.DefaultVariant)
+
+	status := provider.Status()
+	assert.Equal(t, OriginDefaults, status.Origin)
+	assert.True(t, status.Stale())
+	assert.True(t, status.FetchedAt.IsZero())
+
+	// Without defaults there is nothing to serve
+	_, err = NewCachingProvider(failingProvider{}, cache).Load(context.Background())
+	assert.ErrorContains(t, err, "connection refused")
+	assert.ErrorContains(t, err, "load cache")
+}
+
+func TestCachingProvider_CorruptCache(t *testing.T) {
+	cache := filepath.Join(t.TempDir(), "flags.cache.json")
+	require.NoError(t, os.WriteFile(cache, []byte(`{ BROKEN`), 0600))
+	defaults := []byte(`{}`)
+
+	provider := NewCachingProvider(failingProvider{}, cache, WithDefaultFlags(defaults, "json"))
+	_, err := provider.Load(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, OriginDefaults, provider.Status().Origin)
+}
+
+func TestCachingProvider_WatchSavesUpdates(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := filepath.Join(t.TempDir(), "flags.cache.json")
+	source := newChanProvider(map[string]Flag{"a": boolFlag("no")})
+	provider := NewCachingProvider(source, cache)
+	store := NewDynamicStore(ctx, provider)
+	require.NoError(t, store.Start())
+
+	events := make(chan ChangeEvent, 10)
+	store.Subscribe(func(evt ChangeEvent) { events <- evt })
+	source.push(map[string]Flag{"a": boolFlag("yes")})
+	receive(t, events)
+
+	cached, err := NewStoreFromFile(cache)
+	require.NoError(t, err)
+	f, _ := cached.Get("a")
+	assert.Equal(t, "yes", f.DefaultVariant)
+	assert.Equal(t, OriginSource, provider.Status().Origin)
+}
+
+func TestCachingProvider_KeepsCacheWhenFlagsAreInvalid(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := filepath.Join(t.TempDir(), "flags.cache.json")
+	source := newChanProvider(map[string]Flag{"a": boolFlag("yes")})
+	provider := NewCachingProvider(source, cache)
+	store := NewDynamicStore(ctx, provider)
+	require.NoError(t, store.Start())
+	rejections := make(chan RejectedReload, 10)
+	store.SubscribeRejections(func(r RejectedReload) { rejections <- r })
+
+	// The store rejects a reload pointing at a variant which does not exist, and so must the cache
+	source.push(map[string]Flag{"a": boolFlag("missing")})
+	select {
+	case <-rejections:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the reload to be rejected")
+	}
+	assert.ErrorIs(t, provider.Status().Err, errNotCached)
+
+	// Offline, the last known good flags are still served from the cache
+	offline, err := NewCachingProvider(failingProvider{}, cache).Load(context.Background())
+	require.NoError(t, err)
+	f, _ := offline.Get("a")
+	assert.Equal(t, "yes", f.DefaultVariant)
+	assert.False(t, offline.Diagnostics().HasErrors())
+}
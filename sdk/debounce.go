@@ -0,0 +1,50 @@
+package sdk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// DefaultDebounce is how long file providers wait for a burst of changes to finish before reloading.
+const DefaultDebounce = 50 * time.Millisecond
+
+// debouncer coalesces a burst of file events into a single reload, which happens once no event
+// has arrived for the length of the window. C fires when it is time to reload.
+type debouncer struct {
+	window time.Duration
+	timer  *time.Timer
+	C      <-chan time.Time
+}
+
+func newDebouncer(window time.Duration) *debouncer {
+	if window <= 0 {
+		window = DefaultDebounce
+	}
+	return &debouncer{window: window}
+}
+
+// trigger starts the window again
+func (d *debouncer) trigger() {
+	if d.timer == nil {
+		d.timer = time.NewTimer(d.window)
+		d.C = d.timer.C
+		return
+	}
+	d.timer.Reset(d.window)
+}
+
+func (d *debouncer) stop() {
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+}
+
+// contentHash identifies file contents, so a reload can be skipped when they have not changed
+func contentHash(chunks ...[]byte) string {
+	h := sha256.New()
+	for _, chunk := range chunks {
+		_, _ = h.Write(chunk)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,48 @@
+package sdk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebouncer_CoalescesTriggers(t *testing.T) {
+	d := newDebouncer(50 * time.Millisecond)
+	defer d.stop()
+	assert.Nil(t, d.C, "nothing fires until triggered")
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		d.trigger()
+		time.Sleep(20 * time.Millisecond)
+	}
+	<-d.C
+	assert.GreaterOrEqual(t, time.Since(start), 120*time.Millisecond, "each trigger restarts the window")
+
+	select {
+	case <-d.C:
+		t.Fatal("a burst should fire only once")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The debouncer can be used again after firing
+	d.trigger()
+	select {
+	case <-d.C:
+	case <-time.After(time.Second):
+		t.Fatal("expected the debouncer to fire again")
+	}
+}
+
+func TestDebouncer_DefaultWindow(t *testing.T) {
+	assert.Equal(t, DefaultDebounce, newDebouncer(0).window)
+	assert.Equal(t, time.Second, newDebouncer(time.Second).window)
+}
+
+func TestContentHash(t *testing.T) {
+	assert.Equal(t, contentHash([]byte("abc")), contentHash([]byte("a"), []byte("bc")))
+	assert.NotEqual(t, contentHash([]byte("abc")), contentHash([]byte("abd")))
+	assert.NotEqual(t, filesHash([]string{"a.json"}, [][]byte{[]byte("{}")}),
+		filesHash([]string{"b.json"}, [][]byte{[]byte("{}")}), "the file names are part of the hash")
+}
@@ -0,0 +1,340 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DuplicateMode decides what happens when a flag key is defined in more than one file of a directory provider.
+type DuplicateMode int
+
+const (
+	DuplicateError    DuplicateMode = iota // refuse to load the files
+	DuplicateLastWins                      // use the definition from the last file, in lexical order of path
+)
+
+// flagFileExtensions are the files loaded from a directory
+var flagFileExtensions = map[string]bool{".json": true, ".yaml": true, ".yml": true}
+
+func NewDirProvider(pattern string, opts ...Option) StoreProvider {
+	return NewDirProviderWithLog(pattern, nil, opts...)
+}
+
+// NewDirProviderWithLog creates a provider which merges every flag file in a directory, or every file matching
+// a glob pattern such as "flags/*.yaml", into a single Store. Files are reloaded as they are added, removed or
+// changed. Segments are local to the file which defines them.
+func NewDirProviderWithLog(pattern string, writer io.Writer, opts ...Option) StoreProvider {
+	return &dirProvider{pattern: pattern, writer: writer, opts: opts}
+}
+
+// dirProvider implements StoreProvider by watching a set of files on disk.
+type dirProvider struct {
+	pattern string
+	writer  io.Writer
+	opts    []Option
+	observed
+
+	mu    sync.Mutex
+	files []string // the files last loaded
+	hash  string   // hash of the files last loaded
+}
+
+func (p *dirProvider) logEvent(format string, args ...any) {
+	if p.writer != nil {
+		_, _ = p.writer.Write([]byte(strings.TrimSpace(fmt.Sprintf(format, args...)) + "\n"))
+	}
+}
+
+// isDir reports whether the pattern names a directory, rather than being a glob
+func (p *dirProvider) isDir() bool {
+	info, err := os.Stat(p.pattern)
+	return err == nil && info.IsDir()
+}
+
+// match lists the flag files, in lexical order
+func (p *dirProvider) match() ([]string, error) {
+	var files []string
+	if p.isDir() {
+		entries, err := os.ReadDir(p.pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && flagFileExtensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+				files = append(files, filepath.Join(p.pattern, entry.Name()))
+			}
+		}
+	} else {
+		matches, err := filepath.Glob(p.pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && !info.IsDir() {
+				files = append(files, match)
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no flag files match %q", p.pattern)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Load loads and merges every matching file.
+func (p *dirProvider) Load(_ context.Context) (*Store, error) {
+	files, contents, err := p.read()
+	if err != nil {
+		return nil, err
+	}
+	return p.build(files, contents)
+}
+
+// read reads every matching file
+func (p *dirProvider) read() ([]string, [][]byte, error) {
+	files, err := p.match()
+	if err != nil {
+		return nil, nil, err
+	}
+	contents := make([][]byte, len(files))
+	for i, file := range files {
+		if contents[i], err = os.ReadFile(file); err != nil {
+			return nil, nil, fmt.Errorf("read flag file: %w", err)
+		}
+	}
+	return files, contents, nil
+}
+
+// build merges the flags of every file into one store
+func (p *dirProvider) build(files []string, contents [][]byte) (*Store, error) {
+	store, err := mergeFlagFiles(files, contents, p.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.files = files
+	p.hash = filesHash(files, contents)
+	p.mu.Unlock()
+
+	p.logEvent("Store updated from %d files at %s", len(files), time.Now())
+	for _, d := range store.Diagnostics() {
+		p.logEvent("%s", d)
+	}
+	return store, nil
+}
+
+// mergeFlagFiles loads each file, in the format given by its name, and merges their flags into one store.
+// A flag defined in more than one file is an error unless the options allow duplicates.
+func mergeFlagFiles(files []string, contents [][]byte, opts []Option) (*Store, error) {
+	o := newOptions(opts)
+	flags := make(map[string]Flag)
+	definedIn := make(map[string]string)
+	var diags Diagnostics
+	for i, file := range files {
+		store, err := NewStoreFromBytesWithFormat(contents[i], DetectFormat(file), opts...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for _, d := range store.Diagnostics() {
+			d.File = file
+			diags = append(diags, d)
+		}
+		for key, f := range store.flags {
+			if previous, found := definedIn[key]; found {
+				if o.duplicates != DuplicateLastWins {
+					return nil, fmt.Errorf("flag %q is defined in both %s and %s", key, previous, file)
+				}
+				diags = append(diags, Diagnostic{
+					Severity:  SeverityWarning,
+					File:      file,
+					FlagKey:   key,
+					RuleIndex: -1,
+					Message:   fmt.Sprintf("replaces the flag defined in %s", previous),
+				})
+			}
+			flags[key] = f
+			definedIn[key] = file
+		}
+	}
+
+	// The environment was applied as each file was loaded
+	return &Store{flags: flags, diagnostics: mergeDiagnostics(diags, nil), generation: 1}, nil
+}
+
+// reload loads the files again, unless they are all the same as last time
+func (p *dirProvider) reload(onChange func(*Store)) {
+	files, contents, err := p.read()
+	p.apply(files, contents, err, onChange)
+}
+
+// apply loads files which have been read, unless they are all the same as last time, reporting whether they
+// could be loaded
+func (p *dirProvider) apply(files []string, contents [][]byte, err error, onChange func(*Store)) bool {
+	if err == nil {
+		p.mu.Lock()
+		unchanged := filesHash(files, contents) == p.hash
+		p.mu.Unlock()
+		if unchanged {
+			p.reloadSucceeded()
+			return true
+		}
+	}
+
+	var store *Store
+	if err == nil {
+		store, err = p.build(files, contents)
+	}
+	if err != nil {
+		p.logEvent("failed to reload %s: %v", p.pattern, err)
+		p.reloadFailed(err)
+		return false
+	}
+	onChange(store)
+	return true
+}
+
+// poll checks the files for changes at an interval, for when file system notifications are unavailable
+func (p *dirProvider) poll(ctx context.Context, interval time.Duration, onChange func(*Store)) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var failed string // files (or an error reading them) which could not be loaded, so are not retried until they change
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			files, contents, err := p.read()
+			version := ""
+			if err != nil {
+				version = err.Error()
+			} else {
+				version = filesHash(files, contents)
+			}
+			if version == failed {
+				continue
+			}
+			failed = ""
+			if !p.apply(files, contents, err, onChange) {
+				failed = version
+			}
+		}
+	}
+}
+
+// filesHash identifies a set of files by their names and contents
+func filesHash(files []string, contents [][]byte) string {
+	var chunks [][]byte
+	for i, file := range files {
+		chunks = append(chunks, []byte(file), []byte{0}, contents[i], []byte{0})
+	}
+	return contentHash(chunks...)
+}
+
+// watchDirs are the directories which may gain, lose or change matching files
+func (p *dirProvider) watchDirs() []string {
+	dirs := map[string]struct{}{}
+	if p.isDir() {
+		dirs[p.pattern] = struct{}{}
+	} else if dir := filepath.Dir(p.pattern); !strings.ContainsAny(dir, "*?[") {
+		dirs[dir] = struct{}{}
+	}
+	p.mu.Lock()
+	for _, file := range p.files {
+		dirs[filepath.Dir(file)] = struct{}{}
+	}
+	p.mu.Unlock()
+	return sortedKeys(dirs)
+}
+
+// relevant reports whether a change to the given path could change the flags
+func (p *dirProvider) relevant(path string) bool {
+	if p.isDir() {
+		if filepath.Clean(filepath.Dir(path)) != filepath.Clean(p.pattern) {
+			return false
+		}
+		// A Kubernetes ConfigMap volume updates every file at once by swapping its "..data" symlink
+		return flagFileExtensions[strings.ToLower(filepath.Ext(path))] || filepath.Base(path) == "..data"
+	}
+	matched, _ := filepath.Match(p.pattern, path)
+	return matched
+}
+
+// Watch reloads the files when any of them are added, removed or changed. When file system notifications are
+// unavailable (or WithPolling is given) the files are polled for changes instead.
+func (p *dirProvider) Watch(ctx context.Context, onChange func(*Store)) {
+	o := newOptions(p.opts)
+	if o.polling {
+		p.poll(ctx, o.pollInterval, onChange)
+		return
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		p.logEvent("file notifications unavailable, polling %s: %v", p.pattern, err)
+		p.poll(ctx, o.pollInterval, onChange)
+		return
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer watcher.Close()
+	watched := map[string]bool{}
+	watchAll := func() error {
+		var err error
+		for _, dir := range p.watchDirs() {
+			if watched[dir] {
+				continue
+			}
+			if err = watcher.Add(dir); err == nil {
+				watched[dir] = true
+			}
+		}
+		return err
+	}
+	if err := watchAll(); err != nil && len(watched) == 0 {
+		p.logEvent("file notifications unavailable, polling %s: %v", p.pattern, err)
+		p.poll(ctx, o.pollInterval, onChange)
+		return
+	}
+
+	debounce := newDebouncer(o.debounce)
+	defer debounce.stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-debounce.C:
+			p.reload(onChange)
+			_ = watchAll()
+		case evt, ok := <-watcher.Events:
+			if !ok {
+				p.poll(ctx, o.pollInterval, onChange)
+				return
+			}
+			if p.relevant(evt.Name) {
+				debounce.trigger()
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				p.poll(ctx, o.pollInterval, onChange)
+				return
+			}
+			p.logEvent("error watching files: %v", err)
+			p.reloadFailed(fmt.Errorf("watch %s: %w", p.pattern, err))
+		}
+	}
+}
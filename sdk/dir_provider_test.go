@@ -0,0 +1,173 @@
+package sdk
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tommed/ducto-featureflags/test"
+)
+
+func writeFlagFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+}
+
+func boolFlagJSON(defaultVariant string) string {
+	return `{ "variants": ` + test.BoolVariantsJSON() + `, "defaultVariant": "` + defaultVariant + `" }`
+}
+
+func TestDirProvider_MergesFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFlagFiles(t, dir, map[string]string{
+		"payments.json": `{ "checkout": ` + boolFlagJSON("yes") + ` }`,
+		"search.yaml": `
+$schemaVersion: 2
+segments:
+  beta: { if: { group: beta } }
+flags:
+  fuzzy:
+    variants: { yes: true, no: false }
+    defaultVariant: no
+    rules:
+      - segment: beta
+        variant: yes
+`,
+		"README.md":     "not flags",
+		"nested/x.json": `{ "nested": ` + boolFlagJSON("yes") + ` }`,
+		"typo.yml":      `{ "typo": { "variants": { "yes": true }, "defaultVariant": "yes", "ownr": "me" } }`,
+	})
+
+	store, err := NewDirProvider(dir).Load(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, store.AllFlags(), 3)
+
+	fuzzy, ok := store.Get("fuzzy")
+	require.True(t, ok)
+	assert.Equal(t, true, fuzzy.Evaluate(EvalContext{"group": "beta"}).Value)
+	_, ok = store.Get("nested")
+	assert.False(t, ok, "subdirectories are not loaded")
+
+	require.Len(t, store.Diagnostics(), 1)
+	assert.Equal(t, filepath.Join(dir, "typo.yml"), store.Diagnostics()[0].File)
+	assert.Contains(t, store.Diagnostics()[0].String(), "typo.yml: line 1: warning: typo.ownr:")
+}
+
+func TestDirProvider_Glob(t *testing.T) {
+	dir := t.TempDir()
+	writeFlagFiles(t, dir, map[string]string{
+		"a.flags.json": `{ "a": ` + boolFlagJSON("yes") + ` }`,
+		"b.flags.json": `{ "b": ` + boolFlagJSON("yes") + ` }`,
+		"other.json":   `{ "other": ` + boolFlagJSON("yes") + ` }`,
+	})
+
+	store, err := NewDirProvider(filepath.Join(dir, "*.flags.json")).Load(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, sortedKeys(store.AllFlags()))
+
+	_, err = NewDirProvider(filepath.Join(dir, "*.missing")).Load(context.Background())
+	assert.ErrorContains(t, err, "no flag files match")
+}
+
+func TestDirProvider_DuplicateKeys(t *testing.T) {
+	dir := t.TempDir()
+	writeFlagFiles(t, dir, map[string]string{
+		"1-shared.json": `{ "dup": ` + boolFlagJSON("no") + ` }`,
+		"2-team.json":   `{ "dup": ` + boolFlagJSON("yes") + ` }`,
+	})
+
+	_, err := NewDirProvider(dir).Load(context.Background())
+	assert.ErrorContains(t, err, `flag "dup" is defined in both`)
+
+	store, err := NewDirProvider(dir, WithDuplicateKeys(DuplicateLastWins)).Load(context.Background())
+	require.NoError(t, err)
+	f, _ := store.Get("dup")
+	assert.Equal(t, "yes", f.DefaultVariant)
+	require.Len(t, store.Diagnostics(), 1)
+	assert.Equal(t, SeverityWarning, store.Diagnostics()[0].Severity)
+	assert.Contains(t, store.Diagnostics()[0].Message, "1-shared.json")
+}
+
+func TestDirProvider_BadFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFlagFiles(t, dir, map[string]string{"bad.json": `{ BROKEN`})
+	_, err := NewDirProvider(dir).Load(context.Background())
+	assert.ErrorContains(t, err, "bad.json: parse JSON")
+}
+
+func TestDirProvider_Watch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	writeFlagFiles(t, dir, map[string]string{"a.json": `{ "a": ` + boolFlagJSON("no") + ` }`})
+
+	store := NewDynamicStore(ctx, NewDirProvider(dir))
+	require.NoError(t, store.Start())
+	changes := make(chan ChangeEvent, 10)
+	store.Subscribe(func(evt ChangeEvent) { changes <- evt })
+	time.Sleep(100 * time.Millisecond) // let the watcher start
+
+	// Adding a file
+	writeFlagFiles(t, dir, map[string]string{"b.json": `{ "b": ` + boolFlagJSON("no") + ` }`})
+	assert.Equal(t, []string{"b"}, receive(t, changes).Added)
+
+	// Changing a file
+	writeFlagFiles(t, dir, map[string]string{"a.json": `{ "a": ` + boolFlagJSON("yes") + ` }`})
+	assert.Equal(t, []string{"a"}, receive(t, changes).Modified)
+
+	// Removing a file
+	require.NoError(t, os.Remove(filepath.Join(dir, "b.json")))
+	assert.Equal(t, []string{"b"}, receive(t, changes).Removed)
+
+	// Rewriting a file with the same content is not a change
+	generation := store.Snapshot().Generation()
+	writeFlagFiles(t, dir, map[string]string{"a.json": `{ "a": ` + boolFlagJSON("yes") + ` }`})
+	select {
+	case evt := <-changes:
+		t.Fatalf("unexpected change event: %+v", evt)
+	case <-time.After(500 * time.Millisecond):
+	}
+	assert.Equal(t, generation, store.Snapshot().Generation())
+	assert.Equal(t, StateReady, store.Status().State)
+}
+
+func TestDirProvider_Polling(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	writeFlagFiles(t, dir, map[string]string{"a.json": `{ "a": ` + boolFlagJSON("no") + ` }`})
+
+	store := NewDynamicStore(ctx, NewDirProvider(dir, WithPolling(20*time.Millisecond)))
+	require.NoError(t, store.Start())
+	changes := make(chan ChangeEvent, 10)
+	store.Subscribe(func(evt ChangeEvent) { changes <- evt })
+
+	writeFlagFiles(t, dir, map[string]string{"b.json": `{ "b": ` + boolFlagJSON("no") + ` }`})
+	assert.Equal(t, []string{"b"}, receive(t, changes).Added)
+
+	// Files which cannot be loaded are not retried until they change
+	writeFlagFiles(t, dir, map[string]string{"b.json": `{ BROKEN`})
+	time.Sleep(200 * time.Millisecond)
+	status := store.Status()
+	assert.Equal(t, StateStale, status.State)
+	assert.Equal(t, 1, status.ConsecutiveFailures)
+
+	writeFlagFiles(t, dir, map[string]string{"b.json": `{ "b": ` + boolFlagJSON("yes") + ` }`})
+	assert.Equal(t, []string{"b"}, receive(t, changes).Modified)
+	assert.Equal(t, StateReady, store.Status().State)
+}
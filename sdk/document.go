@@ -0,0 +1,189 @@
+package sdk
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentSchemaVersion is the version of the flag file format written by Migrate
+const CurrentSchemaVersion = 2
+
+// Document is the versioned envelope of a flag file. Files may also be a bare map of flags,
+// in which case they are treated as a Document without segments or metadata.
+type Document struct {
+	SchemaVersion int                    `json:"$schemaVersion" yaml:"$schemaVersion" jsonschema:"const=2,optional"`
+	Flags         map[string]Flag        `json:"flags" yaml:"flags"`
+	Segments      map[string]Segment     `json:"segments,omitempty" yaml:"segments,omitempty"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+
+	source   []byte          // the parsed file, for locating diagnostics
+	envelope bool            // whether the flags were inside an envelope
+	legacy   map[string]bool // keys of the flags which were upgraded from v1
+}
+
+// Segment is a named set of context conditions which rules can refer to, instead of repeating them
+type Segment struct {
+	Description string            `json:"description,omitempty" yaml:"description,omitempty"`
+	If          map[string]string `json:"if" yaml:"if"`
+}
+
+// envelopeKeys are the only top-level keys of an envelope
+var envelopeKeys = map[string]bool{"$schemaVersion": true, "flags": true, "segments": true, "metadata": true}
+
+// flagDefinitionFields are the fields of a flag, either version, which show a "flags" key to be a flag itself
+var flagDefinitionFields = []string{"variants", "defaultVariant", "enabled", "rules"}
+
+// ParseDocument parses a flag file in either the envelope or bare form, of either version.
+// Flags in the v1 format are upgraded to v2 variants in memory.
+func ParseDocument(data []byte, format string) (*Document, error) {
+	var probe map[string]interface{}
+	if err := decodeAs(data, format, &probe); err != nil {
+		return nil, err
+	}
+
+	doc := &Document{source: data}
+	rawVersion, versioned := probe["$schemaVersion"]
+	var rawFlags map[string]interface{}
+	if versioned || looksLikeEnvelope(probe) {
+		doc.envelope = true
+		if err := decodeAs(data, format, doc); err != nil {
+			return nil, err
+		}
+		if versioned && doc.SchemaVersion != 1 && doc.SchemaVersion != CurrentSchemaVersion {
+			return nil, fmt.Errorf("unsupported $schemaVersion %v", rawVersion)
+		}
+		rawFlags, _ = probe["flags"].(map[string]interface{})
+	} else {
+		if err := decodeAs(data, format, &doc.Flags); err != nil {
+			return nil, err
+		}
+		rawFlags = probe
+	}
+
+	doc.legacy = map[string]bool{}
+	for key, raw := range rawFlags {
+		if (versioned && doc.SchemaVersion == 1) || (!versioned && isLegacyFlag(raw)) {
+			doc.legacy[key] = true
+		}
+	}
+	if len(doc.legacy) > 0 {
+		if err := doc.upgradeLegacy(data, format); err != nil {
+			return nil, err
+		}
+	}
+	doc.SchemaVersion = CurrentSchemaVersion
+	return doc, nil
+}
+
+// Migrate rewrites a flag file of any version as a current version envelope, in the same format
+func Migrate(data []byte, format string) ([]byte, error) {
+	doc, err := ParseDocument(data, format)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Flags == nil {
+		doc.Flags = map[string]Flag{}
+	}
+	if format == "yaml" {
+		return yaml.Marshal(doc)
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// resolvedFlags returns the flags with the conditions of the segments they refer to merged into their rules
+func (d *Document) resolvedFlags() map[string]Flag {
+	if len(d.Segments) == 0 {
+		return d.Flags
+	}
+	resolved := make(map[string]Flag, len(d.Flags))
+	for key, f := range d.Flags {
+		f.Rules = d.resolveRules(f.Rules)
+		if f.Environments != nil {
+			envs := make(map[string]EnvironmentOverride, len(f.Environments))
+			for env, override := range f.Environments {
+				override.Rules = d.resolveRules(override.Rules)
+				envs[env] = override
+			}
+			f.Environments = envs
+		}
+		resolved[key] = f
+	}
+	return resolved
+}
+
+// resolveRules inlines segments into rules. Rules referring to an undefined segment, or with
+// conditions which contradict their segment, are left with their segment set so they never match.
+func (d *Document) resolveRules(rules []VariantRule) []VariantRule {
+	if rules == nil {
+		return nil
+	}
+	resolved := make([]VariantRule, len(rules))
+	for i, rule := range rules {
+		resolved[i] = rule
+		segment, ok := d.Segments[rule.Segment]
+		if rule.Segment == "" || !ok || len(segmentConflicts(rule, segment)) > 0 {
+			continue
+		}
+		conditions := make(map[string]string, len(rule.If)+len(segment.If))
+		for k, v := range segment.If {
+			conditions[k] = v
+		}
+		for k, v := range rule.If {
+			conditions[k] = v
+		}
+		resolved[i].If = conditions
+		resolved[i].Segment = ""
+	}
+	return resolved
+}
+
+// segmentConflicts lists the context keys on which a rule contradicts its segment
+func segmentConflicts(rule VariantRule, segment Segment) []string {
+	var conflicts []string
+	for k, v := range segment.If {
+		if own, ok := rule.If[k]; ok && own != v {
+			conflicts = append(conflicts, k)
+		}
+	}
+	return conflicts
+}
+
+// looksLikeEnvelope detects an envelope without a $schemaVersion: only envelope keys at the top
+// level, with a "flags" map which is not itself a flag definition.
+func looksLikeEnvelope(probe map[string]interface{}) bool {
+	flags, ok := probe["flags"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for key := range probe {
+		if !envelopeKeys[key] {
+			return false
+		}
+	}
+	for _, field := range flagDefinitionFields {
+		if _, isFlag := flags[field]; isFlag {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeAs(data []byte, format string, v interface{}) error {
+	switch format {
+	case "yaml":
+		if err := yaml.Unmarshal(data, v); err != nil {
+			return fmt.Errorf("parse YAML: %w", err)
+		}
+	default:
+		if err := json.Unmarshal(data, v); err != nil {
+			return fmt.Errorf("parse JSON: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package sdk
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelope_WithSegments(t *testing.T) {
+	for _, name := range []string{"06-envelope.json", "06-envelope.yaml"} {
+		t.Run(name, func(t *testing.T) {
+			store, err := NewStoreFromFile(filepath.Join("..", "examples", name), WithStrictValidation(), WithStrictDecoding())
+			require.NoError(t, err)
+			assert.Empty(t, store.Diagnostics())
+
+			flag, ok := store.Get("new_ui")
+			require.True(t, ok)
+			assert.Equal(t, true, flag.Evaluate(EvalContext{"env": "prod", "group": "beta"}).Value)
+			assert.Equal(t, false, flag.Evaluate(EvalContext{"env": "prod", "group": "alpha"}).Value)
+			assert.Equal(t, false, flag.Evaluate(EvalContext{"group": "beta"}).Value)
+		})
+	}
+}
+
+func TestParseDocument_Bare(t *testing.T) {
+	doc, err := ParseDocument([]byte(`{ "x": { "variants": { "on": true }, "defaultVariant": "on" } }`), "json")
+	require.NoError(t, err)
+	assert.Equal(t, CurrentSchemaVersion, doc.SchemaVersion)
+	assert.Contains(t, doc.Flags, "x")
+	assert.Empty(t, doc.Segments)
+}
+
+func TestParseDocument_UpgradesV1(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		input  string
+	}{
+		{
+			name:   "bare",
+			format: "yaml",
+			input: `
+new_ui:
+  enabled: false
+  rules:
+    - if:
+        env: dev
+      value: true
+    - percent: 20
+      seed: user_id
+      value: true
+`,
+		},
+		{
+			name:   "versioned envelope",
+			format: "json",
+			input: `{
+				"$schemaVersion": 1,
+				"flags": {
+					"new_ui": {
+						"rules": [
+							{ "if": { "env": "dev" }, "value": true },
+							{ "percent": 20, "seed": "user_id", "value": true }
+						]
+					}
+				}
+			}`,
+		},
+		{
+			name:   "unversioned envelope",
+			format: "json",
+			input: `{
+				"flags": {
+					"new_ui": {
+						"enabled": false,
+						"rules": [
+							{ "if": { "env": "dev" }, "value": true },
+							{ "percent": 20, "seed": "user_id", "value": true }
+						]
+					}
+				}
+			}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParseDocument([]byte(tt.input), tt.format)
+			require.NoError(t, err)
+
+			hundred := 20
+			assert.Equal(t, Flag{
+				Type:           TypeBoolean,
+				DefaultVariant: "off",
+				Variants:       map[string]interface{}{"on": true, "off": false},
+				Rules: []VariantRule{
+					{If: map[string]string{"env": "dev"}, Variant: "on"},
+					{Percent: &hundred, Seed: "user_id", Variant: "on"},
+				},
+			}, doc.Flags["new_ui"])
+
+			store, err := NewStoreFromBytesWithFormat([]byte(tt.input), tt.format)
+			require.NoError(t, err)
+			diags := store.Diagnostics()
+			require.Len(t, diags, 1)
+			assert.Contains(t, diags[0].Message, "deprecated v1 format")
+			assert.Greater(t, diags[0].Line, 0)
+		})
+	}
+}
+
+func TestParseDocument_EnabledBecomesDefault(t *testing.T) {
+	doc, err := ParseDocument([]byte(`{ "a": { "enabled": true }, "b": { "variants": { "x": 1 }, "defaultVariant": "x" } }`), "json")
+	require.NoError(t, err)
+	assert.Equal(t, "on", doc.Flags["a"].DefaultVariant)
+	assert.Equal(t, "x", doc.Flags["b"].DefaultVariant, "v2 flags in the same file are left alone")
+}
+
+func TestParseDocument_Errors(t *testing.T) {
+	_, err := ParseDocument([]byte(`{ "$schemaVersion": 3, "flags": {} }`), "json")
+	assert.EqualError(t, err, "unsupported $schemaVersion 3")
+
+	_, err = ParseDocument([]byte(`{ "$schemaVersion": "two" }`), "json")
+	assert.Error(t, err)
+
+	_, err = ParseDocument([]byte(`- not a map`), "yaml")
+	assert.Error(t, err)
+}
+
+func TestEnvelope_Diagnostics(t *testing.T) {
+	input := []byte(`$schemaVersion: 2
+metdata: {}
+segments:
+  beta:
+    if:
+      group: beta
+    desc: typo
+flags:
+  a:
+    variants:
+      on: true
+      off: false
+    defaultVariant: off
+    rules:
+      - segment: missing
+        variant: on
+      - segment: beta
+        if:
+          group: alpha
+        variant: on
+`)
+	diags, err := Validate(input, "yaml")
+	require.NoError(t, err)
+
+	var got []string
+	for _, d := range diags {
+		got = append(got, d.String())
+	}
+	assert.Equal(t, []string{
+		`line 2: warning: metdata: unknown field "metdata" (did you mean "metadata"?)`,
+		`line 7: warning: segments.beta.desc: unknown field "desc"`,
+		`line 15: error: a.rules[0].segment: segment "missing" is not defined`,
+		`line 18: error: a.rules[1].if: conditions on group contradict segment "beta", so the rule never matches`,
+	}, got)
+
+	// Rules with broken segments never match
+	store, err := NewStoreFromBytesWithFormat(input, "yaml")
+	require.NoError(t, err)
+	flag, _ := store.Get("a")
+	assert.Equal(t, false, flag.Evaluate(EvalContext{"group": "alpha"}).Value)
+	assert.Equal(t, false, flag.Evaluate(EvalContext{"group": "beta"}).Value)
+}
+
+func TestMigrate(t *testing.T) {
+	v1 := []byte(`{ "beta": { "enabled": true, "rules": [ { "if": { "env": "prod" }, "value": false } ] } }`)
+	out, err := Migrate(v1, "json")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"$schemaVersion": 2,
+		"flags": {
+			"beta": {
+				"type": "boolean",
+				"defaultVariant": "on",
+				"variants": { "on": true, "off": false },
+				"rules": [ { "if": { "env": "prod" }, "variant": "off" } ]
+			}
+		}
+	}`, string(out))
+
+	// The migrated output is itself a clean v2 document, and migrating is idempotent
+	diags, err := Validate(out, "json")
+	require.NoError(t, err)
+	assert.Empty(t, diags)
+	again, err := Migrate(out, "json")
+	require.NoError(t, err)
+	assert.Equal(t, string(out), string(again))
+}
+
+func TestMigrate_YAMLKeepsSegments(t *testing.T) {
+	data, err := Migrate([]byte(`
+segments:
+  beta:
+    if:
+      group: beta
+flags:
+  a:
+    enabled: false
+    rules:
+      - if:
+          env: dev
+        value: true
+`), "yaml")
+	require.NoError(t, err)
+
+	doc, err := ParseDocument(data, "yaml")
+	require.NoError(t, err)
+	assert.True(t, doc.envelope)
+	assert.Equal(t, map[string]string{"group": "beta"}, doc.Segments["beta"].If)
+	assert.Equal(t, "on", doc.Flags["a"].Rules[0].Variant)
+	assert.Empty(t, doc.legacy)
+}
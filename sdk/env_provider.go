@@ -0,0 +1,213 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// EnvFlagsJSON is the environment variable holding a whole flag document, in JSON.
+	EnvFlagsJSON = "DUCTO_FLAGS_JSON"
+	// EnvFlagPrefix starts the name of each environment variable which sets a single flag, e.g. DUCTO_FLAG_NEW_UI.
+	EnvFlagPrefix = "DUCTO_FLAG_"
+)
+
+// envVariant names the variant created for a value given in an environment variable
+const envVariant = "env"
+
+// NewEnvProvider creates a provider which defines or overrides flags with environment variables, on top of the
+// flags from base (which may be nil, for flags from the environment alone):
+//
+//   - DUCTO_FLAGS_JSON holds a flag document, whose flags replace any of the same key from base.
+//   - DUCTO_FLAG_<KEY> sets one flag. The key is matched ignoring case, with every character other than a letter
+//     or digit written as an underscore, so DUCTO_FLAG_NEW_UI sets "new_ui" or "new-ui". When the value names
+//     one of the flag's variants, that variant is always served. Otherwise the value itself is served: parsed
+//     according to the flag's type if it has one, or else as JSON (so "true" and "3" are a bool and a number),
+//     falling back to a string. A key which matches no flag defines a new one, named in lower case.
+//
+// The overrides are applied again to every update from base.
+func NewEnvProvider(base StoreProvider, opts ...Option) StoreProvider {
+	return &envProvider{base: base, opts: opts, environ: os.Environ}
+}
+
+// envProvider implements StoreProvider by applying environment variables to the flags of another provider.
+type envProvider struct {
+	base    StoreProvider
+	opts    []Option
+	environ func() []string
+	observed
+}
+
+// Load loads the base flags and applies the environment to them.
+func (p *envProvider) Load(ctx context.Context) (*Store, error) {
+	base := &Store{generation: 1}
+	if p.base != nil {
+		var err error
+		if base, err = p.base.Load(ctx); err != nil || base == nil {
+			return nil, err // nil when the base flags are unchanged
+		}
+	}
+	return p.apply(base)
+}
+
+// Watch applies the environment to every update from the base provider.
+func (p *envProvider) Watch(ctx context.Context, onChange func(*Store)) {
+	if p.base == nil {
+		<-ctx.Done()
+		return
+	}
+	p.base.Watch(ctx, func(store *Store) {
+		if store == nil {
+			return
+		}
+		updated, err := p.apply(store)
+		if err != nil {
+			p.reloadFailed(err)
+			return
+		}
+		onChange(updated)
+	})
+}
+
+// Observe registers the observer, and passes it on to the base provider if it reports the outcome of its reloads.
+func (p *envProvider) Observe(observer ProviderObserver) {
+	p.observed.Observe(observer)
+	if observable, ok := p.base.(ObservableProvider); ok {
+		observable.Observe(observer)
+	}
+}
+
+// apply returns a new store with the environment variables applied to the flags of base
+func (p *envProvider) apply(base *Store) (*Store, error) {
+	flags := cloneFlags(base.flags)
+	if flags == nil {
+		flags = make(map[string]Flag)
+	}
+	diags := append(Diagnostics{}, base.diagnostics...)
+
+	vars := make(map[string]string)
+	for _, kv := range p.environ() {
+		if name, value, found := strings.Cut(kv, "="); found {
+			vars[name] = value
+		}
+	}
+
+	if data, found := vars[EnvFlagsJSON]; found && strings.TrimSpace(data) != "" {
+		doc, err := NewStoreFromBytesWithFormat([]byte(data), "json", p.opts...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", EnvFlagsJSON, err)
+		}
+		for key, f := range doc.flags {
+			flags[key] = f
+		}
+		diags = append(diags, doc.diagnostics...)
+	}
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		if strings.HasPrefix(name, EnvFlagPrefix) && len(name) > len(EnvFlagPrefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		key, err := envFlagKey(flags, strings.TrimPrefix(name, EnvFlagPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		f, err := overrideFlag(flags[key], vars[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: flag %q: %w", name, key, err)
+		}
+		flags[key] = f
+	}
+
+	return &Store{flags: flags, diagnostics: diags, generation: 1}, nil
+}
+
+// envFlagKey finds the flag which an environment variable name refers to, which may be in any case
+func envFlagKey(flags map[string]Flag, name string) (string, error) {
+	var matches []string
+	for key := range flags {
+		if envName(key) == envName(name) {
+			matches = append(matches, key)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return strings.ToLower(name), nil
+	case 1:
+		return matches[0], nil
+	}
+	sort.Strings(matches)
+	return "", fmt.Errorf("matches more than one flag: %s", strings.Join(matches, ", "))
+}
+
+// envName is how a flag key is written in the name of an environment variable
+func envName(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// overrideFlag makes the flag always serve the variant named by value, or else value itself
+func overrideFlag(f Flag, value string) (Flag, error) {
+	f.Disabled = false
+	f.Rules = nil
+	f.Environments = nil
+	if _, found := f.Variants[value]; found {
+		f.DefaultVariant = value
+		return f, nil
+	}
+
+	parsed, err := parseEnvValue(f.Type, value)
+	if err != nil {
+		return Flag{}, err
+	}
+	f.Variants = map[string]interface{}{envVariant: parsed}
+	f.DefaultVariant = envVariant
+	if errs := f.checkVariants(); len(errs) > 0 {
+		return Flag{}, errs[0]
+	}
+	return f, nil
+}
+
+// parseEnvValue converts the text of an environment variable to a variant value of the given type
+func parseEnvValue(t FlagType, value string) (interface{}, error) {
+	switch t {
+	case TypeString:
+		return value, nil
+	case TypeBoolean:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", value)
+		}
+		return b, nil
+	case TypeInteger, TypeFloat:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+		return n, nil
+	}
+
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(value), &parsed); err == nil {
+		return parsed, nil
+	}
+	if t == TypeObject {
+		return nil, fmt.Errorf("%q is not a JSON object or array", value)
+	}
+	return value, nil
+}
@@ -0,0 +1,102 @@
+package sdk
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvProvider_Overrides(t *testing.T) {
+	base := newChanProvider(map[string]Flag{
+		"new-ui": {
+			Variants:       map[string]interface{}{"on": true, "off": false},
+			DefaultVariant: "off",
+			Rules:          []VariantRule{{If: map[string]string{"group": "beta"}, Variant: "on"}},
+		},
+		"max_items": {Type: TypeInteger, Variants: map[string]interface{}{"few": 5.0}, DefaultVariant: "few"},
+		"banner":    {Type: TypeString, Variants: map[string]interface{}{"none": ""}, DefaultVariant: "none"},
+		"untouched": boolFlag("no"),
+	})
+	t.Setenv(EnvFlagsJSON, `{ "from_json": `+boolFlagJSON("yes")+`, "untouched": `+boolFlagJSON("yes")+` }`)
+	t.Setenv("DUCTO_FLAG_new_ui", "on")
+	t.Setenv("DUCTO_FLAG_MAX_ITEMS", "20")
+	t.Setenv("DUCTO_FLAG_BANNER", "true")
+	t.Setenv("DUCTO_FLAG_RATE", "0.5")
+	t.Setenv("DUCTO_FLAG_Theme", "dark")
+	t.Setenv("DUCTO_FLAG_LIMITS", `{"max": 3}`)
+
+	store, err := NewEnvProvider(base).Load(context.Background())
+	require.NoError(t, err)
+
+	expected := map[string]interface{}{
+		"new-ui":    true, // the named variant, with the rules removed
+		"max_items": 20.0,
+		"banner":    "true", // a string flag takes the value as it is
+		"untouched": true,   // replaced by DUCTO_FLAGS_JSON
+		"from_json": true,
+		"rate":      0.5,
+		"theme":     "dark",
+		"limits":    map[string]interface{}{"max": 3.0},
+	}
+	for key, want := range expected {
+		result, ok := store.Evaluate(key, EvalContext{"group": "alpha"})
+		require.True(t, ok, key)
+		assert.Equal(t, want, result.Value, key)
+	}
+	f, _ := store.Get("new-ui")
+	assert.Empty(t, f.Rules)
+}
+
+func TestEnvProvider_Errors(t *testing.T) {
+	base := newChanProvider(map[string]Flag{
+		"count": {Type: TypeInteger, Variants: map[string]interface{}{"one": 1.0}, DefaultVariant: "one"},
+		"a-b":   boolFlag("no"),
+		"a_b":   boolFlag("no"),
+	})
+
+	tests := []struct {
+		name, env, value, err string
+	}{
+		{"not a number", "DUCTO_FLAG_COUNT", "many", `"many" is not a number`},
+		{"not an integer", "DUCTO_FLAG_COUNT", "1.5", `flag "count"`},
+		{"ambiguous", "DUCTO_FLAG_A_B", "yes", "matches more than one flag: a-b, a_b"},
+		{"bad document", EnvFlagsJSON, "{ BROKEN", EnvFlagsJSON},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.env, tt.value)
+			_, err := NewEnvProvider(base).Load(context.Background())
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestEnvProvider_Watch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	t.Setenv("DUCTO_FLAG_A", "yes")
+
+	base := newChanProvider(map[string]Flag{"a": boolFlag("no")})
+	store := NewDynamicStore(ctx, NewEnvProvider(base))
+	require.NoError(t, store.Start())
+	changes := make(chan ChangeEvent, 10)
+	store.Subscribe(func(evt ChangeEvent) { changes <- evt })
+
+	// Updates from the base provider are overridden too
+	base.push(map[string]Flag{"a": boolFlag("no"), "b": boolFlag("no")})
+	evt := receive(t, changes)
+	assert.Equal(t, []string{"b"}, evt.Added)
+	f, _ := store.Get("a")
+	assert.Equal(t, "yes", f.DefaultVariant)
+}
+
+func TestEnvProvider_WithoutBase(t *testing.T) {
+	t.Setenv("DUCTO_FLAG_NEW_UI", "false")
+	store, err := NewEnvProvider(nil).Load(context.Background())
+	require.NoError(t, err)
+	result, ok := store.Evaluate("new_ui", nil)
+	assert.True(t, ok)
+	assert.Equal(t, false, result.Value)
+}
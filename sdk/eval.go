@@ -7,14 +7,22 @@ type EvaluationResult struct {
 	Value   interface{}
 	OK      bool
 	Matched bool
+
+	// Generation is the Store generation the flag was evaluated from, when evaluated with Store.Evaluate
+	Generation uint64
 }
 
 // Evaluate performs rule-based or fallback evaluation
 // Evaluate resolves the flag to its chosen variant value
 // File: sdk/flag.go or sdk/eval.go (your call)
 // Flag.Evaluate now returns (variant, value, ok, matched)
+// A disabled flag skips its rules and always resolves to the default variant.
 func (f Flag) Evaluate(ctx EvalContext) EvaluationResult {
-	for _, rule := range f.Rules {
+	var rules []VariantRule
+	if !f.Disabled {
+		rules = f.Rules
+	}
+	for _, rule := range rules {
 		if ruleMatches(rule, ctx) {
 			if rule.Variant == "" {
 				return EvaluationResult{Variant: "", OK: false, Matched: true}
@@ -49,6 +57,11 @@ func (f Flag) Evaluate(ctx EvalContext) EvaluationResult {
 }
 
 func ruleMatches(rule VariantRule, ctx EvalContext) bool {
+	// Segments are merged into the rule on load, so any which remain could not be resolved
+	if rule.Segment != "" {
+		return false
+	}
+
 	// Match conditions
 	for k, v := range rule.If {
 		if ctx[k] != v {
@@ -0,0 +1,162 @@
+package sdk
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// unknownFields walks the source document and reports every key which does not correspond to a
+// field of the Go types it is decoded into. Free-form maps such as variants are not checked.
+func (d *Document) unknownFields(root, flagsRoot *yaml.Node, severity Severity) Diagnostics {
+	var diags Diagnostics
+	reporter := func(flagKey string) func(*yaml.Node, string, []string) {
+		return func(keyNode *yaml.Node, path string, known []string) {
+			diags = append(diags, Diagnostic{
+				Severity:  severity,
+				FlagKey:   flagKey,
+				RuleIndex: ruleIndex(path),
+				Path:      joinPath(path, keyNode.Value),
+				Line:      keyNode.Line,
+				Code:      CodeUnknownField,
+				Message:   unknownFieldMessage(keyNode.Value, known),
+			})
+		}
+	}
+
+	if d.envelope && root.Kind == yaml.MappingNode {
+		known := sortedKeys(knownFields(reflect.TypeOf(Document{})))
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if !envelopeKeys[root.Content[i].Value] {
+				reporter("")(root.Content[i], "", known)
+			}
+		}
+		if segments, _ := childNode(root, "segments"); segments != nil {
+			walkFields(segments, reflect.TypeOf(map[string]Segment{}), "segments", reporter(""))
+		}
+	}
+
+	if flagsRoot == nil || flagsRoot.Kind != yaml.MappingNode {
+		return diags
+	}
+	for i := 0; i+1 < len(flagsRoot.Content); i += 2 {
+		key := flagsRoot.Content[i].Value
+		flagType := reflect.TypeOf(Flag{})
+		if d.legacy[key] {
+			flagType = reflect.TypeOf(flagV1{})
+		}
+		walkFields(flagsRoot.Content[i+1], flagType, "", reporter(key))
+	}
+	return diags
+}
+
+func walkFields(node *yaml.Node, t reflect.Type, path string, report func(*yaml.Node, string, []string)) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		fields := knownFields(t)
+		names := sortedKeys(fields)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode := node.Content[i]
+			field, ok := fields[keyNode.Value]
+			if !ok {
+				report(keyNode, path, names)
+				continue
+			}
+			walkFields(node.Content[i+1], field.Type, joinPath(path, keyNode.Value), report)
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+		for i, item := range node.Content {
+			walkFields(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), report)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode || t.Elem().Kind() == reflect.Interface {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			walkFields(node.Content[i+1], t.Elem(), joinPath(path, node.Content[i].Value), report)
+		}
+	}
+}
+
+// knownFields maps the serialised name of each field of a struct to the field
+func knownFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+// unknownFieldMessage suggests the known field which differs only by case or separators,
+// or else by a few edits (at most two, fewer for short names)
+func unknownFieldMessage(name string, known []string) string {
+	normalised := normaliseFieldName(name)
+	suggestion, best := "", min(2, len(normalised)/3)+1
+	for _, candidate := range known {
+		distance := editDistance(normalised, normaliseFieldName(candidate))
+		if distance < best {
+			suggestion, best = candidate, distance
+		}
+	}
+	if suggestion != "" {
+		return fmt.Sprintf("unknown field %q (did you mean %q?)", name, suggestion)
+	}
+	if name == "enabled" {
+		return `unknown field "enabled" (use "disabled" instead)`
+	}
+	return fmt.Sprintf("unknown field %q", name)
+}
+
+func normaliseFieldName(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+}
+
+// editDistance is the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr := make([]int, len(b)+1)
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev = curr
+	}
+	return prev[len(b)]
+}
+
+// ruleIndex extracts the index of the first rule in a field path, or -1
+func ruleIndex(path string) int {
+	var index int
+	at := strings.Index(path, "rules[")
+	if at < 0 {
+		return -1
+	}
+	if _, err := fmt.Sscanf(path[at:], "rules[%d]", &index); err != nil {
+		return -1
+	}
+	return index
+}
@@ -0,0 +1,86 @@
+package sdk
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const typoFlagsYAML = `new_ui:
+  variants:
+    on: true
+    off: false
+  defaultVariant: off
+  enabled: true
+  rules:
+    - percent: 10
+      seed: user_id
+      seedHash: sha256
+      variant: on
+  environments:
+    prod:
+      default_variant: on
+  metadata:
+    anything: goes
+`
+
+func TestUnknownFields_LenientWarnings(t *testing.T) {
+	store, err := NewStoreFromBytesWithFormat([]byte(typoFlagsYAML), "yaml")
+	require.NoError(t, err)
+
+	var got []string
+	for _, d := range store.Diagnostics() {
+		got = append(got, d.String())
+	}
+	assert.Equal(t, []string{
+		`line 6: warning: new_ui.enabled: unknown field "enabled" (use "disabled" instead)`,
+		`line 10: warning: new_ui.rules[0].seedHash: unknown field "seedHash" (did you mean "seed_hash"?)`,
+		`line 14: warning: new_ui.environments.prod.default_variant: unknown field "default_variant" (did you mean "defaultVariant"?)`,
+	}, got)
+	assert.Equal(t, 0, store.Diagnostics()[1].RuleIndex)
+	assert.Equal(t, -1, store.Diagnostics()[2].RuleIndex)
+}
+
+func TestUnknownFields_Strict(t *testing.T) {
+	_, err := NewStoreFromBytesWithFormat([]byte(typoFlagsYAML), "yaml", WithStrictDecoding())
+	require.Error(t, err)
+
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.Len(t, validationErr.Diagnostics, 3)
+	assert.Equal(t, SeverityError, validationErr.Diagnostics[0].Severity)
+}
+
+func TestUnknownFields_JSONCaseMismatch(t *testing.T) {
+	// encoding/json matches "defaultvariant" case-insensitively, but YAML would not, so it is still reported
+	data := []byte(`{ "x": { "variants": { "on": true }, "defaultvariant": "on" } }`)
+
+	diags, err := Validate(data, "json")
+	require.NoError(t, err)
+	require.Len(t, diags, 1)
+	assert.Equal(t, `unknown field "defaultvariant" (did you mean "defaultVariant"?)`, diags[0].Message)
+	assert.Equal(t, CodeUnknownField, diags[0].Code)
+	assert.Equal(t, SeverityWarning, diags[0].Severity)
+
+	diags, err = Validate(data, "json", WithStrictDecoding())
+	require.NoError(t, err)
+	assert.True(t, diags.HasErrors())
+
+	_, err = NewStoreFromBytesWithFormat(data, "json", WithStrictDecoding())
+	assert.Error(t, err)
+}
+
+func TestUnknownFields_CleanFile(t *testing.T) {
+	_, err := NewStoreFromFile("../examples/05-environments.json", WithStrictDecoding())
+	assert.NoError(t, err)
+}
+
+func TestUnknownFieldMessage(t *testing.T) {
+	known := []string{"defaultVariant", "disabled", "if", "variants"}
+	assert.Equal(t, `unknown field "defaultvariant" (did you mean "defaultVariant"?)`, unknownFieldMessage("defaultvariant", known))
+	assert.Equal(t, `unknown field "varients" (did you mean "variants"?)`, unknownFieldMessage("varients", known))
+	assert.Equal(t, `unknown field "enabled" (use "disabled" instead)`, unknownFieldMessage("enabled", known))
+	assert.Equal(t, `unknown field "x"`, unknownFieldMessage("x", known))
+}
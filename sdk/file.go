@@ -1,37 +1,51 @@
 package sdk
 
 import (
-	"encoding/json"
 	"fmt"
-	"gopkg.in/yaml.v3"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
 // NewStoreFromFile loads flags from a JSON file into memory
-func NewStoreFromFile(path string) (*Store, error) {
+func NewStoreFromFile(path string, opts ...Option) (*Store, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("read flag file: %w", err)
 	}
-	return NewStoreFromBytesWithFormat(data, DetectFormat(path))
+	return NewStoreFromBytesWithFormat(data, DetectFormat(path), opts...)
+}
+
+// NewStoreFromFS loads flags from a file in fsys, such as an embed.FS, detecting its format from the name
+func NewStoreFromFS(fsys fs.FS, name string, opts ...Option) (*Store, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("read flag file: %w", err)
+	}
+	return NewStoreFromBytesWithFormat(data, DetectFormat(name), opts...)
 }
 
 // NewStoreFromBytesWithFormat allows loading from embedded YAML or JSON or remote fetch
-func NewStoreFromBytesWithFormat(data []byte, format string) (*Store, error) {
-	var parsed map[string]Flag
-	switch format {
-	case "yaml":
-		if err := yaml.Unmarshal(data, &parsed); err != nil {
-			return nil, fmt.Errorf("parse YAML: %w", err)
-		}
-	default:
-		if err := json.Unmarshal(data, &parsed); err != nil {
-			return nil, fmt.Errorf("parse JSON: %w", err)
-		}
+func NewStoreFromBytesWithFormat(data []byte, format string, opts ...Option) (*Store, error) {
+	doc, err := ParseDocument(data, format)
+	if err != nil {
+		return nil, err
+	}
+	return newStoreFromDocument(doc, newOptions(opts))
+}
+
+// newStoreFromDocument validates a parsed document as the options require, then builds a Store from it
+func newStoreFromDocument(doc *Document, o options) (*Store, error) {
+	diags, unknown := doc.validate(o)
+	if o.strictDecoding && len(unknown) > 0 {
+		return nil, unknown.Err()
+	}
+	diags = mergeDiagnostics(diags, unknown)
+	if o.strictValidation && diags.HasErrors() {
+		return nil, diags.Err()
 	}
-	return &Store{flags: parsed}, nil
+	return buildStore(doc.resolvedFlags(), diags, o), nil
 }
 
 func DetectFormat(path string) string {
@@ -2,8 +2,11 @@ package sdk
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"os"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -12,20 +15,24 @@ import (
 	"github.com/fsnotify/fsnotify"
 )
 
-func NewFileProvider(path string) StoreProvider {
-	return NewFileProviderWithLog(path, nil)
+func NewFileProvider(path string, opts ...Option) StoreProvider {
+	return NewFileProviderWithLog(path, nil, opts...)
 }
 
-func NewFileProviderWithLog(path string, writer io.Writer) StoreProvider {
-	return &fileProvider{path: path, writer: writer}
+func NewFileProviderWithLog(path string, writer io.Writer, opts ...Option) StoreProvider {
+	return &fileProvider{path: path, writer: writer, opts: opts}
 }
 
 // fileProvider implements StoreProvider by watching a file on disk.
 type fileProvider struct {
-	path     string
-	last     *Store
-	lastLock sync.RWMutex
-	writer   io.Writer
+	path        string
+	last        *Store
+	lastVersion string // fingerprint of the file last loaded
+	lastHash    string // hash of the contents last loaded
+	lastLock    sync.RWMutex
+	writer      io.Writer
+	opts        []Option
+	observed
 }
 
 func (f *fileProvider) logEvent(format string, args ...any) {
@@ -40,52 +47,200 @@ func (f *fileProvider) Load(_ context.Context) (*Store, error) {
 	if err != nil {
 		return nil, err
 	}
-	store, err := NewStoreFromFile(absPath)
+	version := fingerprint(absPath) // before reading, so a change made meanwhile is noticed by the next poll
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("read flag file: %w", err)
+	}
+	return f.loadData(absPath, version, data)
+}
+
+func (f *fileProvider) loadData(absPath, version string, data []byte) (*Store, error) {
+	store, err := NewStoreFromBytesWithFormat(data, DetectFormat(absPath), f.opts...)
 	if err != nil {
 		return nil, err
 	}
 
 	f.lastLock.Lock()
 	f.last = store
+	f.lastVersion = version
+	f.lastHash = contentHash(data)
 	f.lastLock.Unlock()
 	f.logEvent("Store updated at %s", time.Now())
+	for _, d := range store.Diagnostics() {
+		f.logEvent("%s: %s", f.path, d)
+	}
 
 	return store, nil
 }
 
+// Watch reloads the file when it changes. Symlinks are followed, so a Kubernetes ConfigMap volume, which
+// is updated by swapping a "..data" symlink to a new directory, is reloaded too. When file system
+// notifications are unavailable (or WithPolling is given) the file is polled for changes instead.
 func (f *fileProvider) Watch(ctx context.Context, onChange func(*Store)) {
 	absPath, err := filepath.Abs(f.path)
 	if err != nil {
 		return
 	}
+	o := newOptions(f.opts)
+	if o.polling {
+		f.poll(ctx, absPath, o.pollInterval, onChange)
+		return
+	}
 
-	dir := filepath.Dir(absPath)
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
+		f.logEvent("file notifications unavailable, polling %s: %v", f.path, err)
+		f.poll(ctx, absPath, o.pollInterval, onChange)
 		return
 	}
 	//goland:noinspection GoUnhandledErrorResult
 	defer watcher.Close()
-	_ = watcher.Add(dir)
+
+	watched := map[string]bool{}
+	if err := f.addWatches(watcher, absPath, watched); err != nil {
+		f.logEvent("file notifications unavailable, polling %s: %v", f.path, err)
+		f.poll(ctx, absPath, o.pollInterval, onChange)
+		return
+	}
+	target := resolvePath(absPath)
+	debounce := newDebouncer(o.debounce)
+	defer debounce.stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case evt := <-watcher.Events:
+		case <-debounce.C:
+			f.reload(ctx, absPath, onChange)
+		case evt, ok := <-watcher.Events:
+			if !ok {
+				f.poll(ctx, absPath, o.pollInterval, onChange)
+				return
+			}
 			evtPath := filepath.Clean(evt.Name)
-			if evtPath != absPath {
+			if watched[evtPath] && evt.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				delete(watched, evtPath) // the directory itself has gone, e.g. an old ConfigMap revision
+			}
+
+			// Besides changes to the file itself, a change to where it points to means new content
+			current := resolvePath(absPath)
+			if evtPath != absPath && evtPath != target && current == target {
+				continue
+			}
+			target = current
+			_ = f.addWatches(watcher, absPath, watched)
+			if evt.Op == fsnotify.Chmod {
 				continue
 			}
-			if evt.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
-				time.Sleep(50 * time.Millisecond) // debounce
-				store, err := f.Load(ctx)
-				if err == nil {
-					onChange(store)
-				}
+			debounce.trigger()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				f.poll(ctx, absPath, o.pollInterval, onChange)
+				return
 			}
-		case err := <-watcher.Errors:
 			f.logEvent("error watching file: %v", err)
+			f.reloadFailed(fmt.Errorf("watch %s: %w", f.path, err))
+		}
+	}
+}
+
+// addWatches watches the directory of the file and, when the file is a symlink, the directory it points to.
+// Watches are added again as they are needed, as a directory which is removed stops being watched.
+func (f *fileProvider) addWatches(watcher *fsnotify.Watcher, absPath string, watched map[string]bool) error {
+	for _, dir := range []string{filepath.Dir(absPath), filepath.Dir(resolvePath(absPath))} {
+		if watched[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			return err
+		}
+		watched[dir] = true
+	}
+	return nil
+}
+
+// reload loads the file again, unless it is missing (it is usually being replaced, so will be back shortly)
+// or its contents are the same as last time, such as when it has only been touched
+func (f *fileProvider) reload(_ context.Context, absPath string, onChange func(*Store)) {
+	version := fingerprint(absPath)
+	data, err := os.ReadFile(absPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err == nil && contentHash(data) == f.loadedHash() {
+		f.lastLock.Lock()
+		f.lastVersion = version
+		f.lastLock.Unlock()
+		f.reloadSucceeded()
+		return
+	}
+
+	var store *Store
+	if err == nil {
+		store, err = f.loadData(absPath, version, data)
+	}
+	if err != nil {
+		f.logEvent("failed to reload %s: %v", f.path, err)
+		f.reloadFailed(err)
+		return
+	}
+	onChange(store)
+}
+
+// poll checks the file for changes at an interval, for when file system notifications are unavailable
+func (f *fileProvider) poll(ctx context.Context, absPath string, interval time.Duration, onChange func(*Store)) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var failed string // a version which could not be loaded, so is not retried until it changes
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := fingerprint(absPath)
+			if current == "" || current == failed || current == f.loadedVersion() {
+				continue
+			}
+			f.reload(ctx, absPath, onChange)
+			if f.loadedVersion() != current {
+				failed = current
+			}
 		}
 	}
 }
+
+func (f *fileProvider) loadedHash() string {
+	f.lastLock.RLock()
+	defer f.lastLock.RUnlock()
+	return f.lastHash
+}
+
+func (f *fileProvider) loadedVersion() string {
+	f.lastLock.RLock()
+	defer f.lastLock.RUnlock()
+	return f.lastVersion
+}
+
+// resolvePath follows any symlinks in the path, returning it unchanged when that is not possible
+func resolvePath(path string) string {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path
+	}
+	return resolved
+}
+
+// fingerprint identifies the version of a file well enough to notice when it changes
+func fingerprint(path string) string {
+	resolved := resolvePath(path)
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d:%d", resolved, info.Size(), info.ModTime().UnixNano())
+}
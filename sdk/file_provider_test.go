@@ -2,6 +2,7 @@ package sdk
 
 import (
 	"context"
+	"fmt"
 	"github.com/tommed/ducto-featureflags/test"
 	"os"
 	"path/filepath"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func writeTestFlags(t *testing.T, path string, flags string) {
@@ -103,3 +105,161 @@ func TestWatchingStore_HandlesBadFileGracefully(t *testing.T) {
 	assert.True(t, result.OK)
 	assert.Equal(t, true, result.Value)
 }
+
+// swapConfigMap updates a directory the way the kubelet updates a ConfigMap volume: the new files are written
+// to a new directory, which the "..data" symlink is then atomically switched to
+func swapConfigMap(t *testing.T, dir, revision string, files map[string]string) {
+	t.Helper()
+	revisionDir := filepath.Join(dir, revision)
+	require.NoError(t, os.Mkdir(revisionDir, 0755))
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(revisionDir, name), []byte(content), 0644))
+		link := filepath.Join(dir, name)
+		if _, err := os.Lstat(link); err != nil {
+			require.NoError(t, os.Symlink(filepath.Join("..data", name), link))
+		}
+	}
+
+	previous, _ := os.Readlink(filepath.Join(dir, "..data"))
+	require.NoError(t, os.Symlink(revision, filepath.Join(dir, "..data_tmp")))
+	require.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	if previous != "" {
+		require.NoError(t, os.RemoveAll(filepath.Join(dir, previous)))
+	}
+}
+
+func TestWatchingStore_FollowsConfigMapUpdates(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	swapConfigMap(t, dir, "..2025_01_01_00_00_00.1", map[string]string{
+		"flags.json": `{ "new_ui": ` + boolFlagJSON("no") + ` }`,
+	})
+
+	store := NewDynamicStore(ctx, NewFileProvider(filepath.Join(dir, "flags.json")))
+	require.NoError(t, store.Start())
+	changes := make(chan ChangeEvent, 10)
+	store.Subscribe(func(evt ChangeEvent) { changes <- evt })
+	time.Sleep(100 * time.Millisecond) // let the watcher start
+
+	for i, variant := range []string{"yes", "no"} {
+		swapConfigMap(t, dir, fmt.Sprintf("..2025_01_01_00_00_00.%d", i+2), map[string]string{
+			"flags.json": `{ "new_ui": ` + boolFlagJSON(variant) + ` }`,
+		})
+		evt := receive(t, changes)
+		assert.Equal(t, variant, evt.New["new_ui"].DefaultVariant)
+	}
+}
+
+func TestWatchingStore_DirProviderFollowsConfigMapUpdates(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	swapConfigMap(t, dir, "..1", map[string]string{
+		"a.json": `{ "a": ` + boolFlagJSON("no") + ` }`,
+	})
+	store := NewDynamicStore(ctx, NewDirProvider(dir))
+	require.NoError(t, store.Start())
+	changes := make(chan ChangeEvent, 10)
+	store.Subscribe(func(evt ChangeEvent) { changes <- evt })
+	time.Sleep(100 * time.Millisecond)
+
+	swapConfigMap(t, dir, "..2", map[string]string{
+		"a.json": `{ "a": ` + boolFlagJSON("yes") + ` }`,
+		"b.json": `{ "b": ` + boolFlagJSON("yes") + ` }`,
+	})
+	evt := receive(t, changes)
+	assert.Equal(t, []string{"b"}, evt.Added)
+	assert.Equal(t, []string{"a"}, evt.Modified)
+}
+
+func TestWatchingStore_Polling(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	file := filepath.Join(t.TempDir(), "flags.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{ "a": `+boolFlagJSON("no")+` }`), 0644))
+
+	store := NewDynamicStore(ctx, NewFileProvider(file, WithPolling(20*time.Millisecond)))
+	require.NoError(t, store.Start())
+	changes := make(chan ChangeEvent, 10)
+	store.Subscribe(func(evt ChangeEvent) { changes <- evt })
+
+	require.NoError(t, os.WriteFile(file, []byte(`{ "a": `+boolFlagJSON("yes")+`, "b": `+boolFlagJSON("no")+` }`), 0644))
+	evt := receive(t, changes)
+	assert.Equal(t, []string{"b"}, evt.Added)
+
+	// A missing file is not a failed reload, as it is usually being replaced
+	require.NoError(t, os.Remove(file))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, StateReady, store.Status().State)
+	f, _ := store.Get("a")
+	assert.Equal(t, "yes", f.DefaultVariant)
+}
+
+func TestWatchingStore_Debounce(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	file := filepath.Join(t.TempDir(), "flags.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{ "a": `+boolFlagJSON("no")+` }`), 0644))
+
+	store := NewDynamicStore(ctx, NewFileProvider(file, WithDebounce(300*time.Millisecond)))
+	require.NoError(t, store.Start())
+	changes := make(chan ChangeEvent, 10)
+	store.Subscribe(func(evt ChangeEvent) { changes <- evt })
+	time.Sleep(100 * time.Millisecond) // let the watcher start
+
+	// A burst of writes within the window is a single reload of the final content
+	for _, variant := range []string{"yes", "no", "yes"} {
+		require.NoError(t, os.WriteFile(file, []byte(`{ "a": `+boolFlagJSON(variant)+` }`), 0644))
+		time.Sleep(50 * time.Millisecond)
+	}
+	evt := receive(t, changes)
+	assert.Equal(t, []string{"a"}, evt.Modified)
+	assert.Equal(t, "yes", evt.New["a"].DefaultVariant)
+	generation := store.Snapshot().Generation()
+
+	// Writing the same content again, or touching the file, changes nothing
+	require.NoError(t, os.WriteFile(file, []byte(`{ "a": `+boolFlagJSON("yes")+` }`), 0644))
+	now := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(file, now, now))
+	select {
+	case evt := <-changes:
+		t.Fatalf("unexpected change event: %+v", evt)
+	case <-time.After(time.Second):
+	}
+	assert.Equal(t, generation, store.Snapshot().Generation())
+	assert.Equal(t, StateReady, store.Status().State)
+}
+
+func TestFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "flags.json")
+	assert.Equal(t, "", fingerprint(file))
+
+	require.NoError(t, os.WriteFile(file, []byte(`{}`), 0644))
+	first := fingerprint(file)
+	assert.NotEmpty(t, first)
+
+	link := filepath.Join(dir, "link.json")
+	require.NoError(t, os.Symlink(file, link))
+	assert.Equal(t, first, fingerprint(link))
+
+	require.NoError(t, os.WriteFile(file, []byte(`{ }`), 0644))
+	assert.NotEqual(t, first, fingerprint(file))
+}
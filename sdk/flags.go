@@ -1,18 +1,168 @@
 package sdk
 
+import "time"
+
 // Flag represents a single feature flag definition
 type Flag struct {
-	Disabled       bool                   `json:"disabled,omitempty" yaml:"disabled,omitempty"`
-	DefaultVariant string                 `json:"defaultVariant" yaml:"defaultVariant"`
-	Variants       map[string]interface{} `json:"variants" yaml:"variants"`
-	Rules          []VariantRule          `json:"rules,omitempty" yaml:"rules,omitempty"`
+	Disabled       bool                           `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	DefaultVariant string                         `json:"defaultVariant" yaml:"defaultVariant"`
+	Variants       map[string]interface{}         `json:"variants" yaml:"variants"`
+	Rules          []VariantRule                  `json:"rules,omitempty" yaml:"rules,omitempty"`
+	Environments   map[string]EnvironmentOverride `json:"environments,omitempty" yaml:"environments,omitempty"`
+
+	// Optional type checking of the variants, applied when the flag is loaded
+	Type   FlagType               `json:"type,omitempty" yaml:"type,omitempty"`
+	Schema map[string]interface{} `json:"schema,omitempty" yaml:"schema,omitempty"` // JSON Schema for every variant
+
+	// Descriptive fields, these have no effect on evaluation
+	Description string                 `json:"description,omitempty" yaml:"description,omitempty"`
+	Owner       string                 `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Tags        []string               `json:"tags,omitempty" yaml:"tags,omitempty"`
+	CreatedAt   *time.Time             `json:"createdAt,omitempty" yaml:"createdAt,omitempty"`
+	ExpiresAt   *time.Time             `json:"expiresAt,omitempty" yaml:"expiresAt,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty" yaml:"metadata,omitempty"`
 }
 
 // VariantRule is our v2 rule which is OpenFeature compatible and uses 'variants'
 type VariantRule struct {
 	If       map[string]string `json:"if,omitempty" yaml:"if,omitempty"`
-	Variant  string            `json:"variant" yaml:"variant"` // name of the variant to use
-	Percent  *int              `json:"percent,omitempty" yaml:"percent,omitempty"`
+	Segment  string            `json:"segment,omitempty" yaml:"segment,omitempty"` // optional: name of a Segment which must also match
+	Variant  string            `json:"variant" yaml:"variant"`                     // name of the variant to use
+	Percent  *int              `json:"percent,omitempty" yaml:"percent,omitempty" jsonschema:"minimum=0,maximum=100"`
 	Seed     string            `json:"seed,omitempty" yaml:"seed,omitempty"`
-	SeedHash string            `json:"seed_hash,omitempty" yaml:"seed_hash,omitempty"` // optional: "sha256"
+	SeedHash string            `json:"seed_hash,omitempty" yaml:"seed_hash,omitempty" jsonschema:"enum=sha256|fnv"` // optional: "sha256"
+}
+
+// EnvironmentOverride replaces parts of a Flag when its environment is the active one.
+// Unset fields keep the value from the base flag; an empty (but present) rules list removes all rules.
+type EnvironmentOverride struct {
+	Disabled       *bool         `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	DefaultVariant string        `json:"defaultVariant,omitempty" yaml:"defaultVariant,omitempty"`
+	Rules          []VariantRule `json:"rules,omitempty" yaml:"rules,omitempty"`
+}
+
+// ForEnvironment returns a copy of the flag with the overrides for env applied.
+// The returned flag has no Environments of its own, as they have been resolved.
+func (f Flag) ForEnvironment(env string) Flag {
+	override, found := f.Environments[env]
+	f.Environments = nil
+	if !found {
+		return f
+	}
+	if override.Disabled != nil {
+		f.Disabled = *override.Disabled
+	}
+	if override.DefaultVariant != "" {
+		f.DefaultVariant = override.DefaultVariant
+	}
+	if override.Rules != nil {
+		f.Rules = override.Rules
+	}
+	return f
+}
+
+// HasTag reports whether the flag is labelled with the given tag.
+func (f Flag) HasTag(tag string) bool {
+	for _, t := range f.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired reports whether the flag has an expiry date which is before now.
+func (f Flag) Expired(now time.Time) bool {
+	return f.ExpiresAt != nil && f.ExpiresAt.Before(now)
+}
+
+// Clone returns a deep copy of the flag, which shares nothing with the original.
+// Variant, schema and metadata values are copied when they are maps, slices or scalars,
+// as decoded from JSON or YAML; values of any other type are shared.
+func (f Flag) Clone() Flag {
+	f.Variants = cloneMap(f.Variants)
+	f.Rules = cloneRules(f.Rules)
+	f.Schema = cloneMap(f.Schema)
+	f.Metadata = cloneMap(f.Metadata)
+	if f.Tags != nil {
+		f.Tags = append([]string{}, f.Tags...)
+	}
+	if f.CreatedAt != nil {
+		createdAt := *f.CreatedAt
+		f.CreatedAt = &createdAt
+	}
+	if f.ExpiresAt != nil {
+		expiresAt := *f.ExpiresAt
+		f.ExpiresAt = &expiresAt
+	}
+	if f.Environments != nil {
+		environments := make(map[string]EnvironmentOverride, len(f.Environments))
+		for env, override := range f.Environments {
+			if override.Disabled != nil {
+				disabled := *override.Disabled
+				override.Disabled = &disabled
+			}
+			override.Rules = cloneRules(override.Rules)
+			environments[env] = override
+		}
+		f.Environments = environments
+	}
+	return f
+}
+
+func cloneRules(rules []VariantRule) []VariantRule {
+	if rules == nil {
+		return nil
+	}
+	cloned := make([]VariantRule, len(rules))
+	for i, rule := range rules {
+		if rule.If != nil {
+			conditions := make(map[string]string, len(rule.If))
+			for k, v := range rule.If {
+				conditions[k] = v
+			}
+			rule.If = conditions
+		}
+		if rule.Percent != nil {
+			percent := *rule.Percent
+			rule.Percent = &percent
+		}
+		cloned[i] = rule
+	}
+	return cloned
+}
+
+func cloneMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	cloned := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		cloned[k] = cloneValue(v)
+	}
+	return cloned
+}
+
+func cloneValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return cloneMap(t)
+	case []interface{}:
+		cloned := make([]interface{}, len(t))
+		for i, item := range t {
+			cloned[i] = cloneValue(item)
+		}
+		return cloned
+	default:
+		return v
+	}
+}
+
+// cloneFlags returns a deep copy of a set of flags.
+func cloneFlags(flags map[string]Flag) map[string]Flag {
+	cloned := make(map[string]Flag, len(flags))
+	for key, flag := range flags {
+		cloned[key] = flag.Clone()
+	}
+	return cloned
 }
@@ -0,0 +1,95 @@
+package sdk
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlag_ForEnvironment(t *testing.T) {
+	disabled := true
+	f := Flag{
+		Variants:       boolVariants,
+		DefaultVariant: "off",
+		Rules: []VariantRule{
+			{If: map[string]string{"group": "beta"}, Variant: "on"},
+		},
+		Environments: map[string]EnvironmentOverride{
+			"dev":     {DefaultVariant: "on"},
+			"prod":    {Disabled: &disabled},
+			"staging": {Rules: []VariantRule{}},
+		},
+	}
+
+	dev := f.ForEnvironment("dev")
+	assert.Equal(t, "on", dev.DefaultVariant)
+	assert.Len(t, dev.Rules, 1)
+	assert.Nil(t, dev.Environments)
+
+	prod := f.ForEnvironment("prod")
+	assert.True(t, prod.Disabled)
+	assert.Equal(t, "off", prod.DefaultVariant)
+
+	staging := f.ForEnvironment("staging")
+	assert.Empty(t, staging.Rules)
+
+	// Unknown environments fall back to the base definition
+	other := f.ForEnvironment("qa")
+	assert.Equal(t, "off", other.DefaultVariant)
+	assert.Len(t, other.Rules, 1)
+
+	// The original flag is left untouched
+	assert.Len(t, f.Environments, 3)
+	assert.False(t, f.Disabled)
+}
+
+func TestFlagEvaluation_DisabledSkipsRules(t *testing.T) {
+	f := Flag{
+		Disabled:       true,
+		Variants:       boolVariants,
+		DefaultVariant: "off",
+		Rules: []VariantRule{
+			{If: map[string]string{"env": "prod"}, Variant: "on"},
+		},
+	}
+
+	result := f.Evaluate(EvalContext{"env": "prod"})
+	assert.True(t, result.OK)
+	assert.False(t, result.Matched)
+	assert.Equal(t, false, result.Value)
+}
+
+func TestNewStoreFromFile_WithEnvironment(t *testing.T) {
+	for _, name := range []string{"05-environments.json", "05-environments.yaml"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join("..", "examples", name)
+			beta := EvalContext{"group": "beta"}
+			qa := EvalContext{"group": "qa"}
+
+			tests := []struct {
+				env      string
+				ctx      EvalContext
+				expected bool
+			}{
+				{env: "", ctx: beta, expected: true},
+				{env: "", ctx: qa, expected: false},
+				{env: "dev", ctx: qa, expected: true},
+				{env: "staging", ctx: beta, expected: false},
+				{env: "staging", ctx: qa, expected: true},
+				{env: "prod", ctx: beta, expected: false},
+			}
+			for _, tt := range tests {
+				store, err := NewStoreFromFile(path, WithEnvironment(tt.env))
+				require.NoError(t, err)
+
+				flag, ok := store.Get("new_checkout")
+				require.True(t, ok)
+				result := flag.Evaluate(tt.ctx)
+				assert.True(t, result.OK)
+				assert.Equal(t, tt.expected, result.Value, "env=%q ctx=%v", tt.env, tt.ctx)
+			}
+		})
+	}
+}
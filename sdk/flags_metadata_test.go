@@ -0,0 +1,76 @@
+package sdk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlagMetadata_Parses(t *testing.T) {
+	tests := []struct {
+		format string
+		input  string
+	}{
+		{
+			format: "json",
+			input: `{
+				"new_ui": {
+					"variants": { "on": true, "off": false },
+					"defaultVariant": "off",
+					"description": "The redesigned UI",
+					"owner": "team-web",
+					"tags": ["ui", "experiment"],
+					"createdAt": "2025-01-01T00:00:00Z",
+					"expiresAt": "2025-06-01T00:00:00Z",
+					"metadata": { "ticket": "WEB-123", "priority": 2 }
+				}
+			}`,
+		},
+		{
+			format: "yaml",
+			input: `
+new_ui:
+  variants:
+    on: true
+    off: false
+  defaultVariant: off
+  description: The redesigned UI
+  owner: team-web
+  tags: [ui, experiment]
+  createdAt: 2025-01-01T00:00:00Z
+  expiresAt: 2025-06-01T00:00:00Z
+  metadata:
+    ticket: WEB-123
+    priority: 2
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			store, err := NewStoreFromBytesWithFormat([]byte(tt.input), tt.format)
+			require.NoError(t, err)
+
+			flag, ok := store.AllFlags()["new_ui"]
+			require.True(t, ok)
+			assert.Equal(t, "The redesigned UI", flag.Description)
+			assert.Equal(t, "team-web", flag.Owner)
+			assert.Equal(t, []string{"ui", "experiment"}, flag.Tags)
+			require.NotNil(t, flag.CreatedAt)
+			assert.Equal(t, 2025, flag.CreatedAt.Year())
+			require.NotNil(t, flag.ExpiresAt)
+			assert.Equal(t, time.June, flag.ExpiresAt.Month())
+			assert.Equal(t, "WEB-123", flag.Metadata["ticket"])
+
+			assert.True(t, flag.HasTag("ui"))
+			assert.False(t, flag.HasTag("backend"))
+			assert.True(t, flag.Expired(time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)))
+			assert.False(t, flag.Expired(time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)))
+		})
+	}
+}
+
+func TestFlagExpired_NoExpiry(t *testing.T) {
+	assert.False(t, Flag{}.Expired(time.Now()))
+}
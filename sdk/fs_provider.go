@@ -0,0 +1,81 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// NewFSProvider creates a provider which loads flags from fsys, such as an embed.FS, os.DirFS or a zip archive.
+// The pattern names a single file, a directory whose flag files are merged (as by NewDirProvider), or a glob
+// pattern such as "flags/*.yaml", using the slash-separated paths of fs.FS.
+// The files are read once: Watch reports no changes, so it suits defaults layered under a dynamic source.
+func NewFSProvider(fsys fs.FS, pattern string, opts ...Option) StoreProvider {
+	return &fsProvider{fsys: fsys, pattern: pattern, opts: opts}
+}
+
+// fsProvider implements StoreProvider by reading files from an fs.FS.
+type fsProvider struct {
+	fsys    fs.FS
+	pattern string
+	opts    []Option
+}
+
+// Load reads and merges every matching file.
+func (p *fsProvider) Load(_ context.Context) (*Store, error) {
+	files, err := p.match()
+	if err != nil {
+		return nil, err
+	}
+	contents := make([][]byte, len(files))
+	for i, file := range files {
+		if contents[i], err = fs.ReadFile(p.fsys, file); err != nil {
+			return nil, fmt.Errorf("read flag file: %w", err)
+		}
+	}
+	return mergeFlagFiles(files, contents, p.opts)
+}
+
+// Watch does nothing until the context is done, as the files are not expected to change.
+func (p *fsProvider) Watch(ctx context.Context, _ func(*Store)) {
+	<-ctx.Done()
+}
+
+// match lists the flag files, in lexical order
+func (p *fsProvider) match() ([]string, error) {
+	info, err := fs.Stat(p.fsys, p.pattern)
+	if err == nil && !info.IsDir() {
+		return []string{p.pattern}, nil
+	}
+
+	var files []string
+	if err == nil {
+		entries, err := fs.ReadDir(p.fsys, p.pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && flagFileExtensions[strings.ToLower(path.Ext(entry.Name()))] {
+				files = append(files, path.Join(p.pattern, entry.Name()))
+			}
+		}
+	} else {
+		matches, err := fs.Glob(p.fsys, p.pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			if info, err := fs.Stat(p.fsys, match); err == nil && !info.IsDir() {
+				files = append(files, match)
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no flag files match %q", p.pattern)
+	}
+	sort.Strings(files)
+	return files, nil
+}
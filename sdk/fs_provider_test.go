@@ -0,0 +1,83 @@
+package sdk
+
+import (
+	"context"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewStoreFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"flags.yaml": {Data: []byte("a:\n  variants: { yes: true, no: false }\n  defaultVariant: yes\n")},
+	}
+	store, err := NewStoreFromFS(fsys, "flags.yaml")
+	require.NoError(t, err)
+	f, ok := store.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "yes", f.DefaultVariant)
+
+	_, err = NewStoreFromFS(fsys, "missing.json")
+	assert.ErrorContains(t, err, "read flag file")
+
+	// The examples, read through os.DirFS
+	store, err = NewStoreFromFS(os.DirFS("../examples"), "06-envelope.yaml")
+	require.NoError(t, err)
+	_, ok = store.Get("new_ui")
+	assert.True(t, ok)
+}
+
+func TestFSProvider_Load(t *testing.T) {
+	fsys := fstest.MapFS{
+		"defaults/a.json":   {Data: []byte(`{ "a": ` + boolFlagJSON("no") + ` }`)},
+		"defaults/b.yaml":   {Data: []byte("b:\n  variants: { yes: true, no: false }\n  defaultVariant: yes\n")},
+		"defaults/notes.md": {Data: []byte("not flags")},
+		"other/c.json":      {Data: []byte(`{ "c": ` + boolFlagJSON("no") + ` }`)},
+	}
+
+	tests := []struct {
+		pattern string
+		keys    []string
+	}{
+		{"defaults/a.json", []string{"a"}},
+		{"defaults", []string{"a", "b"}},
+		{"*/*.json", []string{"a", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			store, err := NewFSProvider(fsys, tt.pattern).Load(context.Background())
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.keys, sortedKeys(store.AllFlags()))
+		})
+	}
+
+	_, err := NewFSProvider(fsys, "missing/*.json").Load(context.Background())
+	assert.ErrorContains(t, err, `no flag files match "missing/*.json"`)
+}
+
+func TestFSProvider_DefaultsUnderDynamicSource(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	defaults := NewDynamicStore(ctx, NewFSProvider(fstest.MapFS{
+		"defaults.json": {Data: []byte(`{ "a": ` + boolFlagJSON("no") + `, "b": ` + boolFlagJSON("no") + ` }`)},
+	}, "defaults.json"))
+	require.NoError(t, defaults.Start())
+	defer defaults.Close()
+
+	remote := newChanProvider(map[string]Flag{"b": boolFlag("yes")})
+	dynamic := NewDynamicStore(ctx, remote)
+	require.NoError(t, dynamic.Start())
+	defer dynamic.Close()
+
+	store := NewCompositeStore(Layer{Name: "defaults", Store: defaults}, Layer{Name: "remote", Store: dynamic})
+	assert.Equal(t, map[string]string{"a": "defaults", "b": "remote"}, store.Sources())
+
+	// The embedded defaults stay READY, as they never change
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, StateReady, defaults.Status().State)
+}
@@ -1,11 +1,94 @@
 package sdk
 
-import "context"
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// acceptEncodings is the Accept-Encoding header sent for flag files, in the order readBody prefers them
+const acceptEncodings = "zstd, gzip"
+
+// acceptFormats is the Accept header sent for flag files; JSON is preferred, as it is what serve sends by default
+const acceptFormats = "application/json, application/yaml;q=0.9, text/yaml;q=0.9, */*;q=0.1"
 
 // NewStoreFromURL loads a flag file from an HTTP(S) endpoint, but does not update the flags once acquired.
 // Ideally, you would use NewHTTPProvider instead inside a DynamicStore to have an always up-to-date
 // copy of the store from a remote location, but this convenience function exists for one-offs if needed.
-func NewStoreFromURL(ctx context.Context, url string, token string) (*Store, error) {
-	var provider = httpProvider{URL: url, Token: token}
+func NewStoreFromURL(ctx context.Context, url string, token string, opts ...Option) (*Store, error) {
+	var provider = httpProvider{URL: url, Token: token, opts: opts}
 	return provider.Load(ctx)
 }
+
+// responseFormat decides whether a response holds JSON or YAML, from its Content-Type, or else the extension of
+// the URL's path, or else by looking at the body itself
+func responseFormat(resp *http.Response, body []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return "json"
+	case mediaType == "application/yaml" || mediaType == "application/x-yaml" || mediaType == "text/yaml" ||
+		mediaType == "text/x-yaml" || strings.HasSuffix(mediaType, "+yaml"):
+		return "yaml"
+	}
+
+	if resp.Request != nil {
+		switch strings.ToLower(path.Ext(resp.Request.URL.Path)) {
+		case ".json":
+			return "json"
+		case ".yaml", ".yml":
+			return "yaml"
+		}
+	}
+	return sniffFormat(body)
+}
+
+// sniffFormat guesses the format of a flag file from its content: JSON documents start with a brace or bracket
+func sniffFormat(data []byte) string {
+	trimmed := bytes.TrimLeft(data, " \t\r\n\ufeff")
+	if len(trimmed) == 0 || trimmed[0] == '{' || trimmed[0] == '[' {
+		return "json"
+	}
+	return "yaml"
+}
+
+// readBody reads a response, decompressing it if the server compressed it
+func readBody(resp *http.Response) ([]byte, error) {
+	switch encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		return io.ReadAll(resp.Body)
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("decompress response: %w", err)
+		}
+		//goland:noinspection GoUnhandledErrorResult
+		defer reader.Close()
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("decompress response: %w", err)
+		}
+		return body, nil
+	case "zstd":
+		reader, err := zstd.NewReader(resp.Body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("decompress response: %w", err)
+		}
+		defer reader.Close()
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("decompress response: %w", err)
+		}
+		return body, nil
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", encoding)
+	}
+}
@@ -3,46 +3,103 @@ package sdk
 import (
 	"context"
 	"fmt"
-	"io"
+	"math/rand/v2"
 	"net/http"
 	"sync"
 	"time"
+
+	"github.com/tommed/ducto-featureflags/internal/tlsutil"
 )
 
 // httpProvider implements StoreProvider by polling an HTTP endpoint.
+// Requests are conditional on the ETag of the last response, or failing that its Last-Modified time,
+// so a server which supports them (like the serve command) only sends the flags when they change.
 type httpProvider struct {
 	URL       string
 	Token     string
 	Interval  time.Duration
+	lastETag  string
 	lastMod   string
 	lastStore *Store
 	mu        sync.Mutex
+	opts      []Option
+	observed
+
+	clientOnce sync.Once
+	client     *http.Client
+	clientErr  error
 }
 
-func NewHTTPProvider(url string, token string, interval time.Duration) StoreProvider {
+// NewHTTPProvider creates a provider which polls url for flags at the given interval (DefaultPollInterval when it
+// is not positive), sending token (if any) as a bearer token. Failed polls are retried with an exponential backoff (see WithBackoff), and the client, timeout
+// and headers can be set with WithHTTPClient, WithHTTPTimeout and WithHTTPHeader.
+func NewHTTPProvider(url string, token string, interval time.Duration, opts ...Option) StoreProvider {
 	return &httpProvider{
 		URL:      url,
 		Token:    token,
-		Interval: interval,
+		Interval: pollInterval(interval),
+		opts:     opts,
+	}
+}
+
+// pollInterval is the interval to poll at, replacing one which is not positive so polls are not back to back
+func pollInterval(interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return DefaultPollInterval
 	}
+	return interval
 }
 
+// Load fetches the flags. When the server answers that they have not changed since the last load, the store
+// from that load is returned again, so Load always returns a store unless there is an error.
 func (p *httpProvider) Load(ctx context.Context) (*Store, error) {
+	store, err := p.fetch(ctx)
+	if err != nil || store != nil {
+		return store, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastStore, nil
+}
+
+// fetch requests the flags, conditional on the last response, returning nil when they have not changed
+func (p *httpProvider) fetch(ctx context.Context) (*Store, error) {
+	o := newOptions(p.opts)
+	timeout := o.httpTimeout
+	if timeout <= 0 {
+		timeout = DefaultHTTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
 	// Construct the request
 	req, err := http.NewRequestWithContext(ctx, "GET", p.URL, nil)
 	if err != nil {
 		return nil, err
 	}
+	req.Header.Set("Accept", acceptFormats)
+	req.Header.Set("Accept-Encoding", acceptEncodings)
+	for key, values := range o.httpHeaders {
+		req.Header[key] = append([]string{}, values...)
+	}
 	if p.Token != "" {
 		req.Header.Set("Authorization", "Bearer "+p.Token)
 	}
+	p.mu.Lock()
+	if p.lastETag != "" {
+		req.Header.Set("If-None-Match", p.lastETag)
+	}
 	if p.lastMod != "" {
 		req.Header.Set("If-Modified-Since", p.lastMod)
 	}
+	p.mu.Unlock()
 
 	// Do the request
-	resp, err := http.DefaultClient.Do(req)
+	client, err := p.httpClient(o)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -58,12 +115,12 @@ func (p *httpProvider) Load(ctx context.Context) (*Store, error) {
 		return nil, fmt.Errorf("http error: %s", resp.Status)
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := readBody(resp)
 	if err != nil {
 		return nil, err
 	}
 
-	store, err := NewStoreFromBytesWithFormat(body, DetectFormat(p.URL))
+	store, err := NewStoreFromBytesWithFormat(body, responseFormat(resp, body), p.opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -71,24 +128,101 @@ func (p *httpProvider) Load(ctx context.Context) (*Store, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	p.lastStore = store
+	p.lastETag = resp.Header.Get("ETag")
 	p.lastMod = resp.Header.Get("Last-Modified")
 	return store, nil
 }
 
+// httpClient is the client given by WithHTTPClient, or http.DefaultClient, with the TLS options applied.
+// It is made once, so that connections are reused between polls.
+func (p *httpProvider) httpClient(o options) (*http.Client, error) {
+	p.clientOnce.Do(func() {
+		p.client = o.httpClient
+		if p.client == nil {
+			p.client = http.DefaultClient
+		}
+		if o.tls.Empty() {
+			return
+		}
+
+		reloader, err := tlsutil.NewReloader(o.tls)
+		if err != nil {
+			p.clientErr = fmt.Errorf("load TLS certificates: %w", err)
+			return
+		}
+		var transport *http.Transport
+		switch t := p.client.Transport.(type) {
+		case nil:
+			transport = http.DefaultTransport.(*http.Transport)
+		case *http.Transport:
+			transport = t
+		default:
+			p.clientErr = fmt.Errorf("TLS options need an *http.Transport, not %T", t)
+			return
+		}
+		client := *p.client
+		client.Transport = reloader.Transport(transport)
+		p.client = &client
+	})
+	return p.client, p.clientErr
+}
+
+// Watch polls for changes, backing off while the source is failing.
 func (p *httpProvider) Watch(ctx context.Context, onChange func(*Store)) {
-	ticker := time.NewTicker(p.Interval)
-	defer ticker.Stop()
+	o := newOptions(p.opts)
+	failures := 0
+	timer := time.NewTimer(p.nextDelay(o, failures))
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			store, err := p.Load(ctx)
-			if err != nil || store == nil {
-				continue
+		case <-timer.C:
+			store, err := p.fetch(ctx)
+			switch {
+			case err != nil:
+				failures++
+				p.reloadFailed(err)
+			case store == nil: // not modified
+				failures = 0
+				p.reloadSucceeded()
+			default:
+				failures = 0
+				onChange(store)
+			}
+			timer.Reset(p.nextDelay(o, failures))
+		}
+	}
+}
+
+// nextDelay is how long to wait before polling again, after the given number of consecutive failures
+func (p *httpProvider) nextDelay(o options, failures int) time.Duration {
+	if failures == 0 {
+		delay := p.Interval
+		if o.pollJitter > 0 {
+			spread := int64(float64(delay) * o.pollJitter)
+			if spread > 0 {
+				delay += time.Duration(rand.Int64N(2*spread+1) - spread)
 			}
-			onChange(store)
 		}
+		return max(delay, time.Millisecond) // in case of a jitter above 1
 	}
+
+	initial, limit := o.backoffInitial, o.backoffMax
+	if initial <= 0 {
+		initial = p.Interval
+	}
+	if limit <= 0 {
+		limit = DefaultMaxBackoff
+	}
+	delay := initial
+	for i := 1; i < failures && delay < limit; i++ {
+		delay *= 2
+	}
+	delay = min(delay, limit)
+
+	// Wait at least half the delay, and a random amount of the other half
+	half := delay / 2
+	return max(half+time.Duration(rand.Int64N(int64(delay-half)+1)), time.Millisecond)
 }
@@ -2,13 +2,23 @@ package sdk
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"path/filepath"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tommed/ducto-featureflags/internal/tlsutil"
+	"github.com/tommed/ducto-featureflags/test"
 )
 
 func TestHTTPProvider_Load_Success(t *testing.T) {
@@ -41,11 +51,54 @@ func TestHTTPProvider_Load_304(t *testing.T) {
 
 	p := NewHTTPProvider(server.URL, "", time.Second).(*httpProvider)
 
-	_, _ = p.Load(context.Background())        // first load: 200
-	store, err := p.Load(context.Background()) // second load: 304
+	first, _ := p.Load(context.Background())    // first load: 200
+	store, err := p.fetch(context.Background()) // second load: 304
 
 	assert.NoError(t, err)
-	assert.Nil(t, store)
+	assert.Nil(t, store, "polling reports no change")
+
+	// Loading always returns the flags, which are those from the first load
+	store, err = p.Load(context.Background())
+	assert.NoError(t, err)
+	assert.Same(t, first, store)
+}
+
+func TestHTTPProvider_Load_ETag(t *testing.T) {
+	var body atomic.Value
+	body.Store(`{"a":{"variants":{"yes":true,"no":false},"defaultVariant":"no"}}`)
+	var conditional int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := body.Load().(string)
+		etag := fmt.Sprintf(`"%x"`, len(current))
+		assert.Empty(t, r.Header.Get("If-Modified-Since"), "no Last-Modified was sent")
+		if r.Header.Get("If-None-Match") == etag {
+			atomic.AddInt32(&conditional, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(current))
+	}))
+	defer server.Close()
+
+	p := NewHTTPProvider(server.URL, "", time.Second).(*httpProvider)
+	store, err := p.Load(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, store)
+
+	store, err = p.fetch(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, store, "unchanged")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conditional))
+
+	// Changed content has a new ETag, even within the same second
+	body.Store(`{"a":{"variants":{"yes":true,"no":false},"defaultVariant":"yes"}}`)
+	store, err = p.Load(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, store)
+	f, _ := store.Get("a")
+	assert.Equal(t, "yes", f.DefaultVariant)
 }
 
 func TestHTTPProvider_Load_Error(t *testing.T) {
@@ -107,5 +160,283 @@ func TestHTTPProvider_Watch_OnlyFiresOnChange(t *testing.T) {
 	})
 
 	time.Sleep(1100 * time.Millisecond)
-	assert.GreaterOrEqual(t, hits, int32(1))
+	assert.GreaterOrEqual(t, atomic.LoadInt32(&hits), int32(1))
+}
+
+func TestHTTPProvider_ClientOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "abc", r.Header.Get("X-Api-Key"))
+		assert.Equal(t, []string{"a", "b"}, r.Header.Values("X-Team"))
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{"a":{"variants":{"yes":true,"no":false},"defaultVariant":"no"}}`))
+	}))
+	defer server.Close()
+
+	var used int32
+	client := &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&used, 1)
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+	p := NewHTTPProvider(server.URL, "secret", time.Second,
+		WithHTTPClient(client),
+		WithHTTPHeader("X-Api-Key", "abc"),
+		WithHTTPHeader("X-Team", "a"),
+		WithHTTPHeader("X-Team", "b"),
+	)
+	store, err := p.Load(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, store)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&used))
+}
+
+func TestHTTPProvider_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	start := time.Now()
+	_, err := NewHTTPProvider(server.URL, "", time.Second, WithHTTPTimeout(50*time.Millisecond)).Load(context.Background())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestHTTPProvider_NextDelay(t *testing.T) {
+	p := &httpProvider{Interval: time.Second}
+
+	// Without jitter, polls are exactly the interval apart
+	assert.Equal(t, time.Second, p.nextDelay(newOptions(nil), 0))
+
+	// ...and an interval which is not positive means the default, rather than polling continuously
+	for _, interval := range []time.Duration{0, -time.Second} {
+		assert.Equal(t, DefaultPollInterval, NewHTTPProvider("", "", interval).(*httpProvider).nextDelay(newOptions(nil), 0))
+		assert.Equal(t, DefaultPollInterval, NewStreamProvider("", "", "", interval).(*streamProvider).poller.Interval)
+	}
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		failures int
+		min, max time.Duration
+	}{
+		{"poll jitter", []Option{WithPollJitter(0.1)}, 0, 900 * time.Millisecond, 1100 * time.Millisecond},
+		{"first failure", nil, 1, 500 * time.Millisecond, time.Second},
+		{"third failure", nil, 3, 2 * time.Second, 4 * time.Second},
+		{"capped", nil, 100, DefaultMaxBackoff / 2, DefaultMaxBackoff},
+		{"custom backoff", []Option{WithBackoff(100*time.Millisecond, 300*time.Millisecond)}, 2, 100 * time.Millisecond, 200 * time.Millisecond},
+		{"custom cap", []Option{WithBackoff(100*time.Millisecond, 300*time.Millisecond)}, 5, 150 * time.Millisecond, 300 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOptions(tt.opts)
+			for i := 0; i < 100; i++ {
+				delay := p.nextDelay(o, tt.failures)
+				assert.GreaterOrEqual(t, delay, tt.min)
+				assert.LessOrEqual(t, delay, tt.max)
+			}
+		})
+	}
+}
+
+func TestHTTPProvider_Watch_BacksOff(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 700*time.Millisecond)
+	defer cancel()
+
+	// Polling every 20ms would make about 35 requests; backing off from 20ms makes only a handful
+	p := NewHTTPProvider(server.URL, "", 20*time.Millisecond, WithBackoff(20*time.Millisecond, time.Second))
+	p.Watch(ctx, func(*Store) { t.Fatal("no flags should be loaded") })
+	assert.Less(t, atomic.LoadInt32(&requests), int32(10))
+	assert.GreaterOrEqual(t, atomic.LoadInt32(&requests), int32(3))
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestHTTPProvider_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := test.NewCA(t, "ca")
+	caFile := filepath.Join(dir, "ca.pem")
+	ca.WriteCA(t, caFile)
+	serverCert, serverKey := ca.WriteCert(t, dir, "server")
+	clientCert, clientKey := ca.WriteCert(t, dir, "client")
+
+	reloader, err := tlsutil.NewReloader(tlsutil.Files{CertFile: serverCert, KeyFile: serverKey, CAFile: caFile})
+	require.NoError(t, err)
+	config, err := reloader.ServerConfig(true)
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"a":{"variants":{"yes":true,"no":false},"defaultVariant":"no"}}`))
+	}))
+	server.TLS = config
+	server.Config.ErrorLog = log.New(io.Discard, "", 0) // rejected handshakes are expected
+	server.StartTLS()
+	defer server.Close()
+
+	store, err := NewStoreFromURL(context.Background(), server.URL, "", WithTLSCA(caFile), WithTLSClientCert(clientCert, clientKey))
+	require.NoError(t, err)
+	_, ok := store.Get("a")
+	assert.True(t, ok)
+
+	_, err = NewStoreFromURL(context.Background(), server.URL, "", WithTLSCA(caFile))
+	assert.Error(t, err, "a client certificate is required")
+
+	_, err = NewStoreFromURL(context.Background(), server.URL, "", WithTLSCA(filepath.Join(dir, "missing.pem")))
+	assert.ErrorContains(t, err, "load TLS certificates")
+
+	client := &http.Client{Transport: roundTripperFunc(http.DefaultTransport.RoundTrip)}
+	_, err = NewStoreFromURL(context.Background(), server.URL, "", WithHTTPClient(client), WithTLSCA(caFile))
+	assert.ErrorContains(t, err, "TLS options need an *http.Transport")
+}
+
+// newConnectProxy starts an HTTP proxy which tunnels CONNECT requests, counting them
+func newConnectProxy(t *testing.T, tunnels *atomic.Int32) *httptest.Server {
+	t.Helper()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			_ = upstream.Close()
+			return
+		}
+		tunnels.Add(1)
+		_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() {
+			_, _ = io.Copy(upstream, conn)
+			_ = upstream.Close()
+		}()
+		_, _ = io.Copy(conn, upstream)
+		_ = conn.Close()
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+func TestHTTPProvider_MutualTLSThroughProxy(t *testing.T) {
+	dir := t.TempDir()
+	ca := test.NewCA(t, "ca")
+	caFile := filepath.Join(dir, "ca.pem")
+	ca.WriteCA(t, caFile)
+	serverCert, serverKey := ca.WriteCert(t, dir, "server")
+	clientCert, clientKey := ca.WriteCert(t, dir, "client")
+
+	reloader, err := tlsutil.NewReloader(tlsutil.Files{CertFile: serverCert, KeyFile: serverKey, CAFile: caFile})
+	require.NoError(t, err)
+	config, err := reloader.ServerConfig(true)
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"a":{"variants":{"yes":true,"no":false},"defaultVariant":"no"}}`))
+	}))
+	server.TLS = config
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	var tunnels atomic.Int32
+	proxyURL, err := url.Parse(newConnectProxy(t, &tunnels).URL)
+	require.NoError(t, err)
+
+	// The caller's TLS settings are kept alongside the certificates
+	var verified atomic.Int32
+	client := &http.Client{Transport: &http.Transport{
+		Proxy: http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{VerifyConnection: func(tls.ConnectionState) error {
+			verified.Add(1)
+			return nil
+		}},
+	}}
+	store, err := NewStoreFromURL(context.Background(), server.URL, "", WithHTTPClient(client),
+		WithTLSCA(caFile), WithTLSClientCert(clientCert, clientKey))
+	require.NoError(t, err)
+	_, ok := store.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, int32(1), tunnels.Load())
+	assert.Equal(t, int32(1), verified.Load())
+
+	// The server is still verified against the CA
+	other := test.NewCA(t, "other")
+	otherCAFile := filepath.Join(dir, "other.pem")
+	other.WriteCA(t, otherCAFile)
+	_, err = NewStoreFromURL(context.Background(), server.URL, "", WithHTTPClient(client),
+		WithTLSCA(otherCAFile), WithTLSClientCert(clientCert, clientKey))
+	assert.ErrorContains(t, err, "certificate signed by unknown authority")
+}
+
+func TestHTTPProvider_Restart(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(`{"a":{"variants":{"yes":true,"no":false},"defaultVariant":"yes"}}`))
+	}))
+	defer server.Close()
+
+	store := NewDynamicStore(context.Background(), NewHTTPProvider(server.URL, "", time.Hour))
+	defer store.Close()
+	require.NoError(t, store.Start())
+	store.Stop()
+
+	// The server answers the restart with 304 Not Modified, so the flags are kept
+	require.NoError(t, store.Start())
+	f, ok := store.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, "yes", f.DefaultVariant)
+	assert.Equal(t, StateReady, store.Status().State)
+	assert.Equal(t, uint64(1), store.Snapshot().Generation())
+}
+
+func TestHTTPProvider_RejectedReloadStaysStale(t *testing.T) {
+	var body atomic.Value
+	body.Store(`{"a":{"variants":{"yes":true,"no":false},"defaultVariant":"no"}}`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := body.Load().(string)
+		etag := fmt.Sprintf(`"%x"`, len(current))
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(current))
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := NewDynamicStore(ctx, NewHTTPProvider(server.URL, "", 20*time.Millisecond))
+	require.NoError(t, store.Start())
+	defer store.Close()
+
+	// A variant which does not exist is rejected, and the source keeps answering 304 for it
+	body.Store(`{"a":{"variants":{"yes":true,"no":false},"defaultVariant":"missing"}}`)
+	time.Sleep(300 * time.Millisecond)
+	status := store.Status()
+	assert.Equal(t, StateStale, status.State)
+	assert.Equal(t, 1, status.ConsecutiveFailures)
+	f, _ := store.Get("a")
+	assert.Equal(t, "no", f.DefaultVariant)
+
+	// Fixing the source makes the store ready again
+	body.Store(`{"a":{"variants":{"yes":true,"no":false},"defaultVariant":"yes"}}`)
+	assert.Eventually(t, func() bool { return store.Status().State == StateReady }, 2*time.Second, 20*time.Millisecond)
 }
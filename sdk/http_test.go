@@ -1,9 +1,13 @@
 package sdk
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"errors"
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/tommed/ducto-featureflags/test"
 	"net/http"
 	"net/http/httptest"
@@ -111,3 +115,81 @@ canary:
 	assert.True(t, prodEnabled.Value.(bool), "prod")
 	assert.False(t, devEnabled.Value.(bool), "dev")
 }
+
+func TestNewStoreFromURL_FormatDetection(t *testing.T) {
+	yamlPayload := "new_ui:\n  variants: { yes: true, no: false }\n  defaultVariant: yes\n"
+	jsonPayload := `{ "new_ui": { "variants": ` + test.BoolVariantsJSON() + `, "defaultVariant": "yes" } }`
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		payload     string
+	}{
+		{"YAML content type without extension", "/api/flags", "application/yaml", yamlPayload},
+		{"structured suffix", "/api/flags", "application/vnd.flags+json", jsonPayload},
+		{"extension when the content type is generic", "/flags.yaml", "text/plain", yamlPayload},
+		{"sniffed YAML", "/api/flags", "application/octet-stream", yamlPayload},
+		{"sniffed JSON", "/api/flags", "", jsonPayload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Contains(t, r.Header.Get("Accept"), "application/json")
+				assert.Contains(t, r.Header.Get("Accept"), "application/yaml")
+				w.Header()["Content-Type"] = []string{tt.contentType}
+				_, _ = w.Write([]byte(tt.payload))
+			}))
+			defer srv.Close()
+
+			store, err := NewStoreFromURL(context.Background(), srv.URL+tt.path, "")
+			require.NoError(t, err)
+			f, ok := store.Get("new_ui")
+			assert.True(t, ok)
+			assert.Equal(t, "yes", f.DefaultVariant)
+		})
+	}
+}
+
+func TestNewStoreFromURL_Compressed(t *testing.T) {
+	payload := []byte(`{ "new_ui": { "variants": ` + test.BoolVariantsJSON() + `, "defaultVariant": "yes" } }`)
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	_, _ = gz.Write(payload)
+	require.NoError(t, gz.Close())
+	zstdEncoder, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	bodies := map[string][]byte{
+		"gzip": gzipped.Bytes(),
+		"zstd": zstdEncoder.EncodeAll(payload, nil),
+		"br":   payload,
+	}
+
+	encoding := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "zstd, gzip", r.Header.Get("Accept-Encoding"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", encoding)
+		_, _ = w.Write(bodies[encoding])
+	}))
+	defer srv.Close()
+
+	for _, encoding = range []string{"gzip", "zstd"} {
+		store, err := NewStoreFromURL(context.Background(), srv.URL, "")
+		require.NoError(t, err, encoding)
+		_, ok := store.Get("new_ui")
+		assert.True(t, ok, encoding)
+	}
+
+	encoding = "br"
+	_, err = NewStoreFromURL(context.Background(), srv.URL, "")
+	assert.ErrorContains(t, err, `unsupported Content-Encoding "br"`)
+}
+
+func TestSniffFormat(t *testing.T) {
+	assert.Equal(t, "json", sniffFormat([]byte("")))
+	assert.Equal(t, "json", sniffFormat([]byte("\n  {\"a\": 1}")))
+	assert.Equal(t, "json", sniffFormat([]byte("\ufeff{}")))
+	assert.Equal(t, "yaml", sniffFormat([]byte("a: 1")))
+	assert.Equal(t, "yaml", sniffFormat([]byte("---\na: 1")))
+}
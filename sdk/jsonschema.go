@@ -0,0 +1,290 @@
+package sdk
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// validateSchema checks value against a JSON Schema and returns a description of every violation.
+// Only the commonly used subset of the specification is supported: type, enum, const, properties,
+// required, additionalProperties, items, min/max constraints, pattern, allOf/anyOf/oneOf/not,
+// if/then/else and local $ref pointers into root (e.g. "#/$defs/Flag").
+func validateSchema(root, schema map[string]interface{}, value interface{}, path string) []string {
+	c := &schemaChecker{root: root, expanding: map[string]bool{}}
+	return c.check(schema, value, path)
+}
+
+// schemaChecker checks a value against the schemas of root, remembering the $refs being expanded at each path
+// so that a reference back to itself, such as {"$ref": "#"}, is reported rather than followed forever
+type schemaChecker struct {
+	root      map[string]interface{}
+	expanding map[string]bool
+}
+
+func (c *schemaChecker) check(schema map[string]interface{}, value interface{}, path string) []string {
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, displayPath(path)+": "+fmt.Sprintf(format, args...))
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		target, err := resolveSchemaRef(c.root, ref)
+		if err != nil {
+			fail("%v", err)
+			return problems
+		}
+		key := ref + "\x00" + path
+		if c.expanding[key] {
+			fail("$ref %q refers back to itself", ref)
+			return problems
+		}
+		c.expanding[key] = true
+		problems = append(problems, c.check(target, value, path)...)
+		delete(c.expanding, key)
+	}
+
+	if types, ok := schemaTypes(schema["type"]); ok {
+		matched := false
+		for _, t := range types {
+			if schemaTypeMatches(t, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("expected %s, got %s", strings.Join(types, " or "), describeType(value))
+			return problems
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, candidate := range enum {
+			if schemaEqual(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("value is not one of the allowed values")
+		}
+	}
+	if constant, ok := schema["const"]; ok && !schemaEqual(constant, value) {
+		fail("value must be %v", constant)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		problems = append(problems, c.checkObject(schema, v, path)...)
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				problems = append(problems, c.check(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+		if n, ok := schemaNumber(schema, "minItems"); ok && float64(len(v)) < n {
+			fail("must have at least %v items", n)
+		}
+		if n, ok := schemaNumber(schema, "maxItems"); ok && float64(len(v)) > n {
+			fail("must have at most %v items", n)
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if n, ok := schemaNumber(schema, "minLength"); ok && length < n {
+			fail("must be at least %v characters", n)
+		}
+		if n, ok := schemaNumber(schema, "maxLength"); ok && length > n {
+			fail("must be at most %v characters", n)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				fail("invalid pattern %q: %v", pattern, err)
+			} else if !re.MatchString(v) {
+				fail("must match pattern %q", pattern)
+			}
+		}
+	default:
+		if f, isNumber := toFloat(v); isNumber {
+			if n, ok := schemaNumber(schema, "minimum"); ok && f < n {
+				fail("must be >= %v", n)
+			}
+			if n, ok := schemaNumber(schema, "maximum"); ok && f > n {
+				fail("must be <= %v", n)
+			}
+			if n, ok := schemaNumber(schema, "exclusiveMinimum"); ok && f <= n {
+				fail("must be > %v", n)
+			}
+			if n, ok := schemaNumber(schema, "exclusiveMaximum"); ok && f >= n {
+				fail("must be < %v", n)
+			}
+		}
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			if s, ok := sub.(map[string]interface{}); ok {
+				problems = append(problems, c.check(s, value, path)...)
+			}
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok && c.countMatches(anyOf, value, path) == 0 {
+		fail("does not match any of the allowed schemas")
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok && c.countMatches(oneOf, value, path) != 1 {
+		fail("must match exactly one of the allowed schemas")
+	}
+	if not, ok := schema["not"].(map[string]interface{}); ok && len(c.check(not, value, path)) == 0 {
+		fail("must not match the disallowed schema")
+	}
+	if cond, ok := schema["if"].(map[string]interface{}); ok {
+		branch := "else"
+		if len(c.check(cond, value, path)) == 0 {
+			branch = "then"
+		}
+		if s, ok := schema[branch].(map[string]interface{}); ok {
+			problems = append(problems, c.check(s, value, path)...)
+		}
+	}
+	return problems
+}
+
+func (c *schemaChecker) checkObject(schema map[string]interface{}, obj map[string]interface{}, path string) []string {
+	var problems []string
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, found := obj[name]; !found {
+				problems = append(problems, fmt.Sprintf("%s: missing required property %q", displayPath(path), name))
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		childPath := joinPath(path, k)
+		if prop, ok := properties[k].(map[string]interface{}); ok {
+			problems = append(problems, c.check(prop, obj[k], childPath)...)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				problems = append(problems, fmt.Sprintf("%s: property %q is not allowed", displayPath(path), k))
+			}
+		case map[string]interface{}:
+			problems = append(problems, c.check(additional, obj[k], childPath)...)
+		}
+	}
+	return problems
+}
+
+func (c *schemaChecker) countMatches(schemas []interface{}, value interface{}, path string) int {
+	matches := 0
+	for _, sub := range schemas {
+		if s, ok := sub.(map[string]interface{}); ok && len(c.check(s, value, path)) == 0 {
+			matches++
+		}
+	}
+	return matches
+}
+
+func resolveSchemaRef(root map[string]interface{}, ref string) (map[string]interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported $ref %q (only local references are supported)", ref)
+	}
+	var current interface{} = root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot resolve $ref %q", ref)
+		}
+		current = m[part]
+	}
+	target, ok := current.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot resolve $ref %q", ref)
+	}
+	return target, nil
+}
+
+func schemaTypes(raw interface{}) ([]string, bool) {
+	switch t := raw.(type) {
+	case string:
+		return []string{t}, true
+	case []interface{}:
+		var types []string
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types, len(types) > 0
+	}
+	return nil, false
+}
+
+func schemaTypeMatches(t string, value interface{}) bool {
+	switch t {
+	case "null":
+		return value == nil
+	case "boolean":
+		return TypeBoolean.Matches(value)
+	case "string":
+		return TypeString.Matches(value)
+	case "integer":
+		return TypeInteger.Matches(value)
+	case "number":
+		return TypeFloat.Matches(value)
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	}
+	return false
+}
+
+func schemaNumber(schema map[string]interface{}, key string) (float64, bool) {
+	return toFloat(schema[key])
+}
+
+// schemaEqual compares two decoded values, treating numbers of different Go types as equal.
+func schemaEqual(a, b interface{}) bool {
+	af, aNum := toFloat(a)
+	bf, bNum := toFloat(b)
+	if aNum && bNum {
+		return af == bf || (math.IsNaN(af) && math.IsNaN(bf))
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
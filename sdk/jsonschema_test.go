@@ -0,0 +1,134 @@
+package sdk
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateSchema(t *testing.T) {
+	schema := mustDecodeJSON(t, `{
+		"$defs": {
+			"name": { "type": "string", "minLength": 2, "maxLength": 5, "pattern": "^[a-z]+$" }
+		},
+		"type": "object",
+		"properties": {
+			"name": { "$ref": "#/$defs/name" },
+			"level": { "enum": ["low", "high"] },
+			"count": { "type": "integer", "exclusiveMaximum": 10 },
+			"tags": { "type": "array", "items": { "type": "string" }, "maxItems": 2 },
+			"mode": { "oneOf": [ { "const": "a" }, { "const": "b" } ] },
+			"id": { "anyOf": [ { "type": "string" }, { "type": "integer" } ] },
+			"opt": { "type": ["string", "null"] }
+		},
+		"additionalProperties": { "type": "number" }
+	}`)
+
+	tests := []struct {
+		name     string
+		value    string
+		problems []string
+	}{
+		{
+			name:  "valid",
+			value: `{ "name": "abc", "level": "low", "count": 9, "tags": ["a"], "mode": "a", "id": 3, "opt": null, "extra": 1.5 }`,
+		},
+		{
+			name:     "ref",
+			value:    `{ "name": "ABCDEFG" }`,
+			problems: []string{"name: must be at most 5 characters", `name: must match pattern "^[a-z]+$"`},
+		},
+		{
+			name:     "enum",
+			value:    `{ "level": "medium" }`,
+			problems: []string{"level: value is not one of the allowed values"},
+		},
+		{
+			name:     "exclusive maximum",
+			value:    `{ "count": 10 }`,
+			problems: []string{"count: must be < 10"},
+		},
+		{
+			name:     "items",
+			value:    `{ "tags": ["a", 2, "c"] }`,
+			problems: []string{"tags[1]: expected string, got integer", "tags: must have at most 2 items"},
+		},
+		{
+			name:     "oneOf",
+			value:    `{ "mode": "c" }`,
+			problems: []string{"mode: must match exactly one of the allowed schemas"},
+		},
+		{
+			name:     "anyOf",
+			value:    `{ "id": true }`,
+			problems: []string{"id: does not match any of the allowed schemas"},
+		},
+		{
+			name:     "additionalProperties schema",
+			value:    `{ "extra": "text" }`,
+			problems: []string{"extra: expected number, got string"},
+		},
+		{
+			name:     "root type",
+			value:    `[1, 2]`,
+			problems: []string{"(root): expected object, got array"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value interface{}
+			require.NoError(t, json.Unmarshal([]byte(tt.value), &value))
+			assert.Equal(t, tt.problems, validateSchema(schema, schema, value, ""))
+		})
+	}
+}
+
+func TestValidateSchema_BadRef(t *testing.T) {
+	schema := mustDecodeJSON(t, `{ "$ref": "#/$defs/missing" }`)
+	problems := validateSchema(schema, schema, "x", "")
+	assert.Equal(t, []string{`(root): cannot resolve $ref "#/$defs/missing"`}, problems)
+}
+
+func TestValidateSchema_CircularRef(t *testing.T) {
+	schema := mustDecodeJSON(t, `{ "$ref": "#" }`)
+	assert.Equal(t, []string{`(root): $ref "#" refers back to itself`}, validateSchema(schema, schema, "x", ""))
+
+	schema = mustDecodeJSON(t, `{
+		"$defs": { "a": { "$ref": "#/$defs/b" }, "b": { "anyOf": [{ "$ref": "#/$defs/a" }] } },
+		"$ref": "#/$defs/a"
+	}`)
+	assert.Equal(t, []string{"(root): does not match any of the allowed schemas"}, validateSchema(schema, schema, "x", ""))
+
+	// A schema may still refer to itself for nested values
+	schema = mustDecodeJSON(t, `{ "type": "array", "items": { "$ref": "#" } }`)
+	assert.Empty(t, validateSchema(schema, schema, []interface{}{[]interface{}{}, []interface{}{[]interface{}{}}}, ""))
+	assert.Equal(t, []string{"[0][0]: expected array, got string"},
+		validateSchema(schema, schema, []interface{}{[]interface{}{"x"}}, ""))
+}
+
+func mustDecodeJSON(t *testing.T, data string) map[string]interface{} {
+	t.Helper()
+	var result map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(data), &result))
+	return result
+}
+
+func TestValidateSchema_IfThenElse(t *testing.T) {
+	schema := mustDecodeJSON(t, `{
+		"if": { "required": ["kind"] },
+		"then": { "required": ["value"] },
+		"else": { "additionalProperties": { "type": "integer" } }
+	}`)
+
+	check := func(value string) []string {
+		var v interface{}
+		require.NoError(t, json.Unmarshal([]byte(value), &v))
+		return validateSchema(schema, schema, v, "")
+	}
+	assert.Empty(t, check(`{ "kind": "a", "value": 1 }`))
+	assert.Equal(t, []string{`(root): missing required property "value"`}, check(`{ "kind": "a" }`))
+	assert.Empty(t, check(`{ "a": 1 }`))
+	assert.Equal(t, []string{"a: expected integer, got string"}, check(`{ "a": "x" }`))
+}
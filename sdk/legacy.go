@@ -0,0 +1,92 @@
+package sdk
+
+// flagV1 is a flag in the deprecated v1 format (see docs/spec-flags-v1.md)
+type flagV1 struct {
+	Enabled *bool    `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Rules   []ruleV1 `json:"rules,omitempty" yaml:"rules,omitempty"`
+}
+
+type ruleV1 struct {
+	If       map[string]string `json:"if,omitempty" yaml:"if,omitempty"`
+	Value    bool              `json:"value" yaml:"value"`
+	Percent  *int              `json:"percent,omitempty" yaml:"percent,omitempty"`
+	Seed     string            `json:"seed,omitempty" yaml:"seed,omitempty"`
+	SeedHash string            `json:"seed_hash,omitempty" yaml:"seed_hash,omitempty"`
+}
+
+const (
+	legacyOn  = "on"
+	legacyOff = "off"
+)
+
+// upgrade converts a v1 boolean flag into v2 "on" and "off" variants.
+// In v1 "enabled" was only the fallback value, so it becomes the default variant.
+func (f flagV1) upgrade() Flag {
+	upgraded := Flag{
+		Type:           TypeBoolean,
+		DefaultVariant: legacyVariant(f.Enabled != nil && *f.Enabled),
+		Variants:       map[string]interface{}{legacyOn: true, legacyOff: false},
+	}
+	for _, rule := range f.Rules {
+		upgraded.Rules = append(upgraded.Rules, VariantRule{
+			If:       rule.If,
+			Variant:  legacyVariant(rule.Value),
+			Percent:  rule.Percent,
+			Seed:     rule.Seed,
+			SeedHash: rule.SeedHash,
+		})
+	}
+	return upgraded
+}
+
+func legacyVariant(value bool) string {
+	if value {
+		return legacyOn
+	}
+	return legacyOff
+}
+
+// isLegacyFlag detects a v1 flag in a file without a $schemaVersion: it has no variants, but
+// has "enabled" or a rule with a "value".
+func isLegacyFlag(raw interface{}) bool {
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	if _, hasVariants := m["variants"]; hasVariants {
+		return false
+	}
+	if _, hasEnabled := m["enabled"]; hasEnabled {
+		return true
+	}
+	rules, _ := m["rules"].([]interface{})
+	for _, rule := range rules {
+		if r, ok := rule.(map[string]interface{}); ok {
+			if _, hasValue := r["value"]; hasValue {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeLegacy decodes the flags marked as legacy in the v1 format and replaces them with v2 flags
+func (d *Document) upgradeLegacy(data []byte, format string) error {
+	var legacyFlags map[string]flagV1
+	if d.envelope {
+		var envelope struct {
+			Flags map[string]flagV1 `json:"flags" yaml:"flags"`
+		}
+		if err := decodeAs(data, format, &envelope); err != nil {
+			return err
+		}
+		legacyFlags = envelope.Flags
+	} else if err := decodeAs(data, format, &legacyFlags); err != nil {
+		return err
+	}
+
+	for key := range d.legacy {
+		d.Flags[key] = legacyFlags[key].upgrade()
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package sdk
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/tommed/ducto-featureflags/internal/tlsutil"
+)
+
+// Option customises how a Store is loaded, e.g. by NewStoreFromFile or a StoreProvider,
+// or how a DynamicStore behaves.
+type Option func(*options)
+
+type options struct {
+	environment      string
+	strictValidation bool
+	strictDecoding   bool
+	defaults         []byte
+	defaultsFormat   string
+
+	stalenessThreshold time.Duration
+	historySize        int
+	duplicates         DuplicateMode
+	polling            bool
+	pollInterval       time.Duration
+	debounce           time.Duration
+
+	httpClient     *http.Client
+	httpTimeout    time.Duration
+	httpHeaders    http.Header
+	backoffInitial time.Duration
+	backoffMax     time.Duration
+	pollJitter     float64
+	tls            tlsutil.Files
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
+
+// WithEnvironment selects the environment whose overrides (see Flag.Environments) are applied
+// to every flag as it is loaded. An empty name leaves the flags untouched.
+func WithEnvironment(env string) Option {
+	return func(o *options) {
+		o.environment = env
+	}
+}
+
+// WithStrictValidation rejects flag files whose validation (see Validate) reports any errors,
+// such as a rule pointing at a variant which does not exist. By default these are only reported
+// by Store.Diagnostics.
+func WithStrictValidation() Option {
+	return func(o *options) {
+		o.strictValidation = true
+	}
+}
+
+// WithStrictDecoding rejects flag files containing fields which are not part of the flag format,
+// which are usually typos such as "defaultvariant" or "seedHash". By default these are only
+// reported as warnings by Store.Diagnostics.
+func WithStrictDecoding() Option {
+	return func(o *options) {
+		o.strictDecoding = true
+	}
+}
+
+// WithDefaultFlags gives a CachingProvider the flags to serve when neither its source nor its cache
+// can be loaded, typically a file embedded in the binary. The format is "json" or "yaml".
+func WithDefaultFlags(data []byte, format string) Option {
+	return func(o *options) {
+		o.defaults = data
+		o.defaultsFormat = format
+	}
+}
+
+// WithStalenessThreshold makes a DynamicStore report itself as STALE (see DynamicStore.Status) when the
+// flags have not been loaded, or confirmed unchanged, for longer than the threshold.
+// This suits polling providers such as NewHTTPProvider, which check the source regularly.
+func WithStalenessThreshold(threshold time.Duration) Option {
+	return func(o *options) {
+		o.stalenessThreshold = threshold
+	}
+}
+
+// WithHistorySize sets how many previous generations of flags a DynamicStore keeps for Rollback.
+// The default is DefaultHistorySize.
+func WithHistorySize(size int) Option {
+	return func(o *options) {
+		o.historySize = size
+	}
+}
+
+// WithDuplicateKeys sets how NewDirProvider handles a flag key defined in more than one file.
+// The default is DuplicateError.
+func WithDuplicateKeys(mode DuplicateMode) Option {
+	return func(o *options) {
+		o.duplicates = mode
+	}
+}
+
+// DefaultPollInterval is how often a file is checked for changes when it has to be polled, and how often an
+// HTTP provider polls when given an interval which is not positive.
+const DefaultPollInterval = 5 * time.Second
+
+// WithPolling makes file and directory providers check for changes at the given interval, instead of relying
+// on file system notifications, which some file systems (such as network mounts) do not deliver. Polling is
+// used anyway when notifications are unavailable, at this interval or DefaultPollInterval.
+func WithPolling(interval time.Duration) Option {
+	return func(o *options) {
+		o.polling = true
+		o.pollInterval = interval
+	}
+}
+
+// WithDebounce sets how long file providers wait for a burst of changes to a file to finish before
+// reloading it, so that a file written in several steps is only loaded once it is complete.
+// The default is DefaultDebounce.
+func WithDebounce(window time.Duration) Option {
+	return func(o *options) {
+		o.debounce = window
+	}
+}
+
+// WithHTTPClient sets the client used by NewHTTPProvider and NewStoreFromURL, e.g. to use a proxy or
+// custom transport. The default is http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// DefaultHTTPTimeout limits how long each request made by NewHTTPProvider and NewStoreFromURL may take.
+const DefaultHTTPTimeout = 30 * time.Second
+
+// WithHTTPTimeout limits how long each HTTP request may take, including reading the response.
+// The default is DefaultHTTPTimeout.
+func WithHTTPTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.httpTimeout = timeout
+	}
+}
+
+// WithHTTPHeader adds a header to every HTTP request, such as an API key. It may be given more than once.
+func WithHTTPHeader(key, value string) Option {
+	return func(o *options) {
+		if o.httpHeaders == nil {
+			o.httpHeaders = make(http.Header)
+		}
+		o.httpHeaders.Add(key, value)
+	}
+}
+
+// WithTLSClientCert makes NewHTTPProvider and NewStoreFromURL present a client certificate, for servers which
+// require mutual TLS (such as serve with -tls-require-client-cert). The files are PEM encoded, and are reloaded
+// for new connections whenever they change, so rotated certificates are picked up without a restart.
+func WithTLSClientCert(certFile, keyFile string) Option {
+	return func(o *options) {
+		o.tls.CertFile = certFile
+		o.tls.KeyFile = keyFile
+	}
+}
+
+// WithTLSCA makes NewHTTPProvider and NewStoreFromURL trust only the certificate authorities in the given PEM
+// file to sign the server's certificate, instead of the system's. Like WithTLSClientCert, it is reloaded when it changes.
+func WithTLSCA(caFile string) Option {
+	return func(o *options) {
+		o.tls.CAFile = caFile
+	}
+}
+
+// DefaultMaxBackoff is the longest NewHTTPProvider waits between attempts while its source is failing.
+const DefaultMaxBackoff = 5 * time.Minute
+
+// WithBackoff sets how NewHTTPProvider retries while its source is failing. The wait after the first failure is
+// initial, doubling after each further failure up to max, with a random jitter of up to half of each wait so that
+// many instances do not retry in lockstep. The defaults are the poll interval and DefaultMaxBackoff.
+func WithBackoff(initial, max time.Duration) Option {
+	return func(o *options) {
+		o.backoffInitial = initial
+		o.backoffMax = max
+	}
+}
+
+// WithPollJitter varies each wait between polls of NewHTTPProvider by up to the given fraction of the
+// interval, in either direction, e.g. 0.1 for ±10%. The default is no jitter.
+func WithPollJitter(fraction float64) Option {
+	return func(o *options) {
+		o.pollJitter = fraction
+	}
+}
+
+// unknownFieldSeverity is how fields which are not part of the flag format are reported
+func (o options) unknownFieldSeverity() Severity {
+	if o.strictDecoding {
+		return SeverityError
+	}
+	return SeverityWarning
+}
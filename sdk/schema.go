@@ -0,0 +1,198 @@
+package sdk
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// schemaDescriber is implemented by types which describe their own JSON Schema
+type schemaDescriber interface {
+	jsonSchema() map[string]interface{}
+}
+
+// JSONSchema returns the JSON Schema of the flag file format, generated from the Go types.
+// Files which ParseDocument takes to be an envelope must be a Document, or with $schemaVersion 1 an envelope
+// of v1 flags; otherwise they are a bare map of flags.
+func JSONSchema() map[string]interface{} {
+	gen := schemaGenerator{defs: map[string]interface{}{}}
+	return map[string]interface{}{
+		"$schema": jsonSchemaDraft,
+		"title":   "Ducto feature flags (v2)",
+		"type":    "object",
+		"if": map[string]interface{}{
+			"anyOf": []interface{}{
+				map[string]interface{}{"required": []interface{}{"$schemaVersion"}},
+				unversionedEnvelopeSchema(),
+			},
+		},
+		"then": map[string]interface{}{
+			"if": map[string]interface{}{
+				"required":   []interface{}{"$schemaVersion"},
+				"properties": map[string]interface{}{"$schemaVersion": map[string]interface{}{"const": 1}},
+			},
+			"then": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"$schemaVersion": map[string]interface{}{"const": 1},
+					"flags":          gen.schemaFor(reflect.TypeOf(map[string]flagV1{})),
+					"segments":       gen.schemaFor(reflect.TypeOf(map[string]Segment{})),
+					"metadata":       gen.schemaFor(reflect.TypeOf(map[string]interface{}{})),
+				},
+				"required":             []interface{}{"$schemaVersion", "flags"},
+				"additionalProperties": false,
+			},
+			"else": gen.schemaFor(reflect.TypeOf(Document{})),
+		},
+		"else": map[string]interface{}{
+			"additionalProperties": gen.schemaFor(reflect.TypeOf(Flag{})),
+		},
+		"$defs": gen.defs,
+	}
+}
+
+// unversionedEnvelopeSchema matches the envelopes without a $schemaVersion detected by looksLikeEnvelope
+func unversionedEnvelopeSchema() map[string]interface{} {
+	properties := map[string]interface{}{}
+	for key := range envelopeKeys {
+		properties[key] = map[string]interface{}{}
+	}
+	var flagFields []interface{}
+	for _, field := range flagDefinitionFields {
+		flagFields = append(flagFields, map[string]interface{}{"required": []interface{}{field}})
+	}
+	properties["flags"] = map[string]interface{}{
+		"type": "object",
+		"not":  map[string]interface{}{"anyOf": flagFields},
+	}
+	return map[string]interface{}{
+		"required":             []interface{}{"flags"},
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+// JSONSchemaBytes returns JSONSchema as indented JSON
+func JSONSchemaBytes() []byte {
+	data, _ := json.MarshalIndent(JSONSchema(), "", "  ")
+	return append(data, '\n')
+}
+
+type schemaGenerator struct {
+	defs map[string]interface{}
+}
+
+func (g schemaGenerator) schemaFor(t reflect.Type) map[string]interface{} {
+	if describer, ok := reflect.Zero(t).Interface().(schemaDescriber); ok {
+		return describer.jsonSchema()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schemaFor(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		return g.structRef(t)
+	default: // interface{} accepts anything
+		return map[string]interface{}{}
+	}
+}
+
+// structRef adds the struct to $defs (once) and returns a reference to it
+func (g schemaGenerator) structRef(t reflect.Type) map[string]interface{} {
+	ref := map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	if _, done := g.defs[t.Name()]; done {
+		return ref
+	}
+	g.defs[t.Name()] = nil // placeholder, in case of recursion
+
+	properties := map[string]interface{}{}
+	var required []interface{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		if tag[0] == "" || tag[0] == "-" {
+			continue
+		}
+		prop := g.schemaFor(field.Type)
+		schemaTag := field.Tag.Get("jsonschema")
+		applySchemaTag(prop, schemaTag)
+		properties[tag[0]] = prop
+		if !containsString(tag[1:], "omitempty") && !containsString(strings.Split(schemaTag, ","), "optional") {
+			required = append(required, tag[0])
+		}
+	}
+
+	def := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		def["required"] = required
+	}
+	g.defs[t.Name()] = def
+	return ref
+}
+
+// applySchemaTag adds the constraints from a `jsonschema:"minimum=0,maximum=100,enum=a|b"` tag.
+// The tag may also mark a field "optional", when it is not required despite being written without omitempty.
+func applySchemaTag(schema map[string]interface{}, tag string) {
+	if tag == "" {
+		return
+	}
+	for _, part := range strings.Split(tag, ",") {
+		name, value, _ := strings.Cut(part, "=")
+		switch name {
+		case "optional":
+			// see structRef
+		case "enum":
+			var values []interface{}
+			for _, v := range strings.Split(value, "|") {
+				values = append(values, v)
+			}
+			schema["enum"] = values
+		default:
+			if n, err := strconv.ParseFloat(value, 64); err == nil {
+				schema[name] = n
+			} else {
+				schema[name] = value
+			}
+		}
+	}
+}
+
+func (FlagType) jsonSchema() map[string]interface{} {
+	values := make([]interface{}, 0, len(FlagTypes))
+	for _, t := range FlagTypes {
+		values = append(values, string(t))
+	}
+	return map[string]interface{}{"type": "string", "enum": values}
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package sdk
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestJSONSchema_ExamplesValidate(t *testing.T) {
+	schema := JSONSchema()
+	files, err := filepath.Glob(filepath.Join("..", "examples", "*"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			doc := loadSchemaDocument(t, file)
+			assert.Empty(t, validateSchema(schema, schema, doc, ""))
+		})
+	}
+
+	// Envelopes which are not in the examples, but which ParseDocument accepts
+	fixtures := map[string]string{
+		"unversioned envelope": `{ "flags": { "x": { "variants": { "on": true }, "defaultVariant": "on" } }, "metadata": { "team": "web" } }`,
+		"v1 envelope":          `{ "$schemaVersion": 1, "flags": { "x": { "enabled": true, "rules": [ { "if": { "env": "dev" }, "value": false } ] } } }`,
+	}
+	for name, fixture := range fixtures {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseDocument([]byte(fixture), "json")
+			require.NoError(t, err)
+			var doc interface{}
+			require.NoError(t, json.Unmarshal([]byte(fixture), &doc))
+			assert.Empty(t, validateSchema(schema, schema, doc, ""))
+		})
+	}
+}
+
+func TestJSONSchema_RejectsInvalidEnvelopes(t *testing.T) {
+	schema := JSONSchema()
+	tests := []struct {
+		name     string
+		doc      string
+		problems []string
+	}{
+		{"unsupported version", `{ "$schemaVersion": 3, "flags": {} }`, []string{"$schemaVersion: value must be 2"}},
+		{"v2 flags in a v1 envelope", `{ "$schemaVersion": 1, "flags": { "x": { "variants": { "on": true }, "defaultVariant": "on" } } }`,
+			[]string{`flags.x: property "defaultVariant" is not allowed`, `flags.x: property "variants" is not allowed`}},
+		{"v1 flags in an unversioned envelope", `{ "flags": { "x": { "enabled": true } } }`,
+			[]string{`flags.x: missing required property "defaultVariant"`, `flags.x: missing required property "variants"`, `flags.x: property "enabled" is not allowed`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc interface{}
+			require.NoError(t, json.Unmarshal([]byte(tt.doc), &doc))
+			assert.Equal(t, tt.problems, validateSchema(schema, schema, doc, ""))
+		})
+	}
+}
+
+func TestJSONSchema_RejectsInvalidFlags(t *testing.T) {
+	schema := JSONSchema()
+	var doc interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"new_ui": {
+			"variants": { "on": true },
+			"defaultvariant": "on",
+			"type": "bool",
+			"rules": [ { "variant": "on", "percent": 150, "seed_hash": "md5" } ]
+		}
+	}`), &doc))
+
+	assert.Equal(t, []string{
+		`new_ui: missing required property "defaultVariant"`,
+		`new_ui: property "defaultvariant" is not allowed`,
+		`new_ui.rules[0].percent: must be <= 100`,
+		`new_ui.rules[0].seed_hash: value is not one of the allowed values`,
+		`new_ui.type: value is not one of the allowed values`,
+	}, validateSchema(schema, schema, doc, ""))
+}
+
+func TestJSONSchema_PublishedCopyIsUpToDate(t *testing.T) {
+	published, err := os.ReadFile(filepath.Join("..", "docs", "flags.schema.json"))
+	require.NoError(t, err)
+	assert.Equal(t, string(JSONSchemaBytes()), string(published), "run `make schema` to regenerate")
+}
+
+// loadSchemaDocument decodes a flag file the way a JSON Schema validator would see it
+func loadSchemaDocument(t *testing.T, path string) interface{} {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var doc interface{}
+	if DetectFormat(path) == "yaml" {
+		require.NoError(t, yaml.Unmarshal(data, &doc))
+		// Round trip through JSON, so YAML-only types (e.g. timestamps) become their JSON equivalents
+		data, err = json.Marshal(doc)
+		require.NoError(t, err)
+	}
+	require.NoError(t, json.Unmarshal(data, &doc))
+	return doc
+}
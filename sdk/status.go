@@ -0,0 +1,100 @@
+package sdk
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// State summarises the health of a DynamicStore. The names match the OpenFeature provider states.
+type State string
+
+const (
+	StateNotReady State = "NOT_READY" // Start has not been called
+	StateReady    State = "READY"     // the flags are up to date
+	StateStale    State = "STALE"     // flags are being served, but they may be out of date
+	StateError    State = "ERROR"     // no flags could be loaded
+)
+
+// Status describes the health of a DynamicStore.
+type Status struct {
+	State               State
+	LastSuccess         time.Time // when the source was last loaded or checked successfully
+	LastError           error     // the most recent failure, even if the source has recovered since
+	LastErrorAt         time.Time
+	ConsecutiveFailures int // failures since the last success
+}
+
+// ProviderObserver is told the outcome of the reloads a provider attempts while watching.
+// Without it, a reload which fails or finds nothing has changed is invisible to the DynamicStore.
+type ProviderObserver interface {
+	ReloadSucceeded()
+	ReloadFailed(err error)
+}
+
+// ObservableProvider is implemented by providers which report the outcome of their reloads.
+// DynamicStore registers itself as the observer before the first Load.
+type ObservableProvider interface {
+	StoreProvider
+	Observe(observer ProviderObserver)
+}
+
+// cacheStatuser is implemented by providers which may serve stale flags from a cache, like CachingProvider
+type cacheStatuser interface {
+	Status() CacheStatus
+}
+
+// observed can be embedded in a provider to make it an ObservableProvider.
+type observed struct {
+	observerMu sync.RWMutex
+	observer   ProviderObserver
+}
+
+func (o *observed) Observe(observer ProviderObserver) {
+	o.observerMu.Lock()
+	defer o.observerMu.Unlock()
+	o.observer = observer
+}
+
+func (o *observed) reloadSucceeded() {
+	o.observerMu.RLock()
+	defer o.observerMu.RUnlock()
+	if o.observer != nil {
+		o.observer.ReloadSucceeded()
+	}
+}
+
+func (o *observed) reloadFailed(err error) {
+	o.observerMu.RLock()
+	defer o.observerMu.RUnlock()
+	if o.observer != nil {
+		o.observer.ReloadFailed(err)
+	}
+}
+
+// storeObserver records the outcome of a provider's reloads in the status of a DynamicStore.
+type storeObserver struct {
+	d *DynamicStore
+}
+
+// ReloadSucceeded records a check which found the source unchanged. If the flags it last provided were
+// rejected they are still invalid, so the failure stands until the source changes.
+func (o storeObserver) ReloadSucceeded() {
+	o.d.mu.Lock()
+	defer o.d.mu.Unlock()
+	if !o.d.rejected {
+		o.d.recordSuccess()
+		o.d.notifyStatus()
+	}
+}
+
+func (o storeObserver) ReloadFailed(err error) {
+	o.d.mu.Lock()
+	defer o.d.mu.Unlock()
+	var diags Diagnostics
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		diags = invalid.Diagnostics
+	}
+	o.d.rejectReload(err, diags)
+}
@@ -3,24 +3,80 @@ package sdk
 type AnyStore interface {
 	Get(key string) (Flag, bool) // For OpenFeature compatibility
 	AllFlags() map[string]Flag
+	Snapshot() *Store // A view of the flags which never changes, for evaluating several flags consistently
 }
 
 // Store is a AnyStore which holds the provided flags and never updates.
+// It owns its flags: they are copied on the way in (NewStore) and on the way out (Get, AllFlags),
+// so callers can never change what other readers see.
 type Store struct {
-	flags map[string]Flag
+	flags       map[string]Flag
+	diagnostics Diagnostics
+	generation  uint64
 }
 
-func NewStore(flags map[string]Flag) AnyStore {
-	return &Store{flags: flags}
+// NewStore creates a Store from a copy of the given flags.
+func NewStore(flags map[string]Flag, opts ...Option) AnyStore {
+	return newStore(cloneFlags(flags), newOptions(opts))
 }
 
-// Get just returns the Flag now, so doesn't need EvalContext at this stage
+// newStore builds a Store which takes ownership of the flags, resolving environment overrides when an environment is selected.
+// Flags are validated before any overrides are resolved, so problems in every environment are reported.
+func newStore(flags map[string]Flag, o options) *Store {
+	return buildStore(flags, ValidateFlags(flags), o)
+}
+
+func buildStore(flags map[string]Flag, diags Diagnostics, o options) *Store {
+	if o.environment != "" {
+		resolved := make(map[string]Flag, len(flags))
+		for key, flag := range flags {
+			resolved[key] = flag.ForEnvironment(o.environment)
+		}
+		flags = resolved
+	}
+	return &Store{flags: flags, diagnostics: diags, generation: 1}
+}
+
+// Get just returns a copy of the Flag now, so doesn't need EvalContext at this stage
 func (s *Store) Get(key string) (Flag, bool) {
 	f, ok := s.flags[key]
-	return f, ok
+	if !ok {
+		return Flag{}, false
+	}
+	return f.Clone(), true
+}
+
+// Evaluate evaluates the flag with the given key, recording the store's generation in the result.
+// It reports false when there is no such flag.
+func (s *Store) Evaluate(key string, ctx EvalContext) (EvaluationResult, bool) {
+	f, ok := s.flags[key]
+	if !ok {
+		return EvaluationResult{Generation: s.generation}, false
+	}
+	result := f.Evaluate(ctx)
+	result.Value = cloneValue(result.Value)
+	result.Generation = s.generation
+	return result, true
 }
 
-// AllFlags returns the raw flag map
+// AllFlags returns a copy of every flag, which the caller is free to change
 func (s *Store) AllFlags() map[string]Flag {
-	return s.flags
+	return cloneFlags(s.flags)
+}
+
+// Diagnostics returns the problems found when the flags were validated on load.
+// Unless WithStrictValidation was used these may include errors.
+func (s *Store) Diagnostics() Diagnostics {
+	return s.diagnostics
+}
+
+// Snapshot returns the store itself, as a Store never changes once it has been loaded.
+func (s *Store) Snapshot() *Store {
+	return s
+}
+
+// Generation identifies the version of the flags held by the store.
+// A loaded Store is generation 1; the snapshots of a DynamicStore count up from 1 each time its flags change.
+func (s *Store) Generation() uint64 {
+	return s.generation
 }
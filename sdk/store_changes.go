@@ -0,0 +1,134 @@
+package sdk
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// ChangeEvent describes how the flags of a DynamicStore changed when it was updated.
+// Keys are sorted; Old holds the previous definitions of removed and modified flags, New holds
+// the definitions of added and modified flags.
+type ChangeEvent struct {
+	Added    []string
+	Removed  []string
+	Modified []string
+	Old      map[string]Flag
+	New      map[string]Flag
+	Time     time.Time
+
+	// Generation of the store's snapshot once the change was applied
+	Generation uint64
+}
+
+// RejectedReload describes a reload of a DynamicStore which was not applied, so the previous flags are still served.
+type RejectedReload struct {
+	Time        time.Time
+	Err         error
+	Diagnostics Diagnostics // the problems found, when the flags loaded but failed validation
+}
+
+// Keys returns every key which changed, sorted.
+func (e ChangeEvent) Keys() []string {
+	keys := make(map[string]struct{}, len(e.Added)+len(e.Removed)+len(e.Modified))
+	for _, group := range [][]string{e.Added, e.Removed, e.Modified} {
+		for _, key := range group {
+			keys[key] = struct{}{}
+		}
+	}
+	return sortedKeys(keys)
+}
+
+// Empty reports whether the event has no changes.
+func (e ChangeEvent) Empty() bool {
+	return len(e.Added) == 0 && len(e.Removed) == 0 && len(e.Modified) == 0
+}
+
+// diffFlags compares two sets of flags, either of which may be nil.
+// The event holds copies of the flags, so subscribers cannot change the store's own.
+func diffFlags(before, after map[string]Flag) ChangeEvent {
+	evt := ChangeEvent{Old: map[string]Flag{}, New: map[string]Flag{}}
+	for _, key := range sortedKeys(before) {
+		old := before[key]
+		updated, found := after[key]
+		switch {
+		case !found:
+			evt.Removed = append(evt.Removed, key)
+			evt.Old[key] = old.Clone()
+		case !reflect.DeepEqual(old, updated):
+			evt.Modified = append(evt.Modified, key)
+			evt.Old[key] = old.Clone()
+			evt.New[key] = updated.Clone()
+		}
+	}
+	for _, key := range sortedKeys(after) {
+		if _, found := before[key]; !found {
+			evt.Added = append(evt.Added, key)
+			evt.New[key] = after[key].Clone()
+		}
+	}
+	return evt
+}
+
+// subscriber delivers events to a single callback from its own goroutine, in the order they
+// were published. The queue is unbounded, so publishing never blocks on a slow callback.
+type subscriber[E any] struct {
+	fn    func(E)
+	mu    sync.Mutex
+	queue []E
+	wake  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newSubscriber[E any](fn func(E)) *subscriber[E] {
+	return &subscriber[E]{
+		fn:   fn,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+}
+
+func (s *subscriber[E]) publish(evt E) {
+	s.mu.Lock()
+	s.queue = append(s.queue, evt)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscriber[E]) stop() {
+	s.once.Do(func() { close(s.done) })
+}
+
+func (s *subscriber[E]) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.done:
+			return
+		case <-s.wake:
+		}
+		for {
+			s.mu.Lock()
+			if len(s.queue) == 0 {
+				s.mu.Unlock()
+				break
+			}
+			evt := s.queue[0]
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			s.fn(evt)
+		}
+	}
+}
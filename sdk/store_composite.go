@@ -0,0 +1,169 @@
+package sdk
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Layer is a named store within a CompositeStore.
+type Layer struct {
+	Name  string
+	Store AnyStore
+}
+
+// subscribable is implemented by stores which report changes, such as DynamicStore and CompositeStore.
+type subscribable interface {
+	Subscribe(fn func(ChangeEvent)) (unsubscribe func())
+}
+
+// CompositeStore is a AnyStore which layers several stores on top of each other.
+// Layers are given from the bottom up: when more than one layer has a flag, the last of them wins.
+// For example, a shared remote store, then local developer overrides, then emergency overrides.
+type CompositeStore struct {
+	layers []Layer
+
+	mu                sync.Mutex
+	subscribers       map[*subscriber[ChangeEvent]]struct{}
+	unsubscribeLayers []func()
+	current           map[string]Flag // the view subscribers were last told about
+}
+
+// NewCompositeStore creates a store from layers of stores, in increasing order of precedence.
+func NewCompositeStore(layers ...Layer) *CompositeStore {
+	return &CompositeStore{layers: append([]Layer{}, layers...)}
+}
+
+// Layers returns the layers of the store, from the bottom up.
+func (c *CompositeStore) Layers() []Layer {
+	return append([]Layer{}, c.layers...)
+}
+
+// Get retrieves a flag from the highest layer which has it.
+func (c *CompositeStore) Get(key string) (Flag, bool) {
+	for i := len(c.layers) - 1; i >= 0; i-- {
+		if f, ok := c.layers[i].Store.Get(key); ok {
+			return f, true
+		}
+	}
+	return Flag{}, false
+}
+
+// Source returns the name of the layer which serves the flag with the given key.
+func (c *CompositeStore) Source(key string) (string, bool) {
+	for i := len(c.layers) - 1; i >= 0; i-- {
+		if _, ok := c.layers[i].Store.Snapshot().flags[key]; ok {
+			return c.layers[i].Name, true
+		}
+	}
+	return "", false
+}
+
+// Sources returns the name of the layer serving each flag.
+func (c *CompositeStore) Sources() map[string]string {
+	sources := make(map[string]string)
+	for _, layer := range c.layers {
+		for key := range layer.Store.Snapshot().flags {
+			sources[key] = layer.Name
+		}
+	}
+	return sources
+}
+
+// AllFlags returns every flag, each taken from the highest layer which has it.
+func (c *CompositeStore) AllFlags() map[string]Flag {
+	return c.Snapshot().AllFlags()
+}
+
+// Snapshot merges a snapshot of every layer into a single Store.
+// Its generation is the sum of the layers' generations, so it increases whenever any layer changes.
+// Diagnostics are not merged; they remain available from each layer.
+func (c *CompositeStore) Snapshot() *Store {
+	flags, generation := c.merge()
+	return &Store{flags: flags, generation: generation}
+}
+
+func (c *CompositeStore) merge() (map[string]Flag, uint64) {
+	flags := make(map[string]Flag)
+	var generation uint64
+	for _, layer := range c.layers {
+		snapshot := layer.Store.Snapshot()
+		for key, f := range snapshot.flags {
+			flags[key] = f
+		}
+		generation += snapshot.generation
+	}
+	return flags, generation
+}
+
+// Subscribe registers fn to be called whenever a change to any layer changes the merged flags.
+// A change which is hidden by a higher layer is not reported. Delivery follows the same rules as
+// DynamicStore.Subscribe; the returned function unsubscribes.
+func (c *CompositeStore) Subscribe(fn func(ChangeEvent)) (unsubscribe func()) {
+	sub := newSubscriber(fn)
+
+	c.mu.Lock()
+	if len(c.subscribers) == 0 {
+		c.watchLayers()
+	}
+	c.subscribers[sub] = struct{}{}
+	c.mu.Unlock()
+
+	go sub.run(context.Background())
+
+	return func() {
+		c.mu.Lock()
+		if _, found := c.subscribers[sub]; found {
+			delete(c.subscribers, sub)
+			if len(c.subscribers) == 0 {
+				c.unwatchLayers()
+			}
+		}
+		c.mu.Unlock()
+		sub.stop()
+	}
+}
+
+// watchLayers starts listening to the layers which report changes. The lock must be held.
+func (c *CompositeStore) watchLayers() {
+	c.subscribers = make(map[*subscriber[ChangeEvent]]struct{})
+	c.current, _ = c.merge()
+	for _, layer := range c.layers {
+		if s, ok := layer.Store.(subscribable); ok {
+			c.unsubscribeLayers = append(c.unsubscribeLayers, s.Subscribe(func(ChangeEvent) {
+				c.layerChanged()
+			}))
+		}
+	}
+}
+
+// unwatchLayers stops listening to the layers once nobody is subscribed. The lock must be held.
+func (c *CompositeStore) unwatchLayers() {
+	for _, unsubscribe := range c.unsubscribeLayers {
+		unsubscribe()
+	}
+	c.unsubscribeLayers = nil
+	c.current = nil
+}
+
+// layerChanged works out how the merged flags changed, rather than forwarding the layer's own event,
+// so that precedence is taken into account.
+func (c *CompositeStore) layerChanged() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.subscribers) == 0 {
+		return
+	}
+
+	merged, generation := c.merge()
+	evt := diffFlags(c.current, merged)
+	c.current = merged
+	if evt.Empty() {
+		return
+	}
+	evt.Time = time.Now()
+	evt.Generation = generation
+	for sub := range c.subscribers {
+		sub.publish(evt)
+	}
+}
@@ -0,0 +1,101 @@
+package sdk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompositeStore_Precedence(t *testing.T) {
+	store := NewCompositeStore(
+		Layer{Name: "remote", Store: NewStore(map[string]Flag{"a": boolFlag("no"), "b": boolFlag("no"), "c": boolFlag("no")})},
+		Layer{Name: "local", Store: NewStore(map[string]Flag{"b": boolFlag("yes"), "c": boolFlag("yes")})},
+		Layer{Name: "emergency", Store: NewStore(map[string]Flag{"c": boolFlag("no")})},
+	)
+
+	expected := map[string]struct {
+		variant string
+		source  string
+	}{
+		"a": {"no", "remote"},
+		"b": {"yes", "local"},
+		"c": {"no", "emergency"},
+	}
+	for key, want := range expected {
+		f, ok := store.Get(key)
+		assert.True(t, ok, key)
+		assert.Equal(t, want.variant, f.DefaultVariant, key)
+
+		source, ok := store.Source(key)
+		assert.True(t, ok, key)
+		assert.Equal(t, want.source, source, key)
+	}
+	assert.Equal(t, map[string]string{"a": "remote", "b": "local", "c": "emergency"}, store.Sources())
+
+	_, ok := store.Get("missing")
+	assert.False(t, ok)
+	_, ok = store.Source("missing")
+	assert.False(t, ok)
+
+	all := store.AllFlags()
+	assert.Len(t, all, 3)
+	assert.Equal(t, "yes", all["b"].DefaultVariant)
+
+	snapshot := store.Snapshot()
+	assert.Equal(t, uint64(3), snapshot.Generation())
+	result, ok := snapshot.Evaluate("b", nil)
+	assert.True(t, ok)
+	assert.Equal(t, true, result.Value)
+	assert.Equal(t, []string{"remote", "local", "emergency"}, []string{
+		store.Layers()[0].Name, store.Layers()[1].Name, store.Layers()[2].Name,
+	})
+}
+
+func TestCompositeStore_ForwardsChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	remote := newChanProvider(map[string]Flag{"a": boolFlag("no"), "b": boolFlag("no")})
+	remoteStore := NewDynamicStore(ctx, remote)
+	require.NoError(t, remoteStore.Start())
+
+	overrides := newChanProvider(map[string]Flag{"b": boolFlag("yes")})
+	overrideStore := NewDynamicStore(ctx, overrides)
+	require.NoError(t, overrideStore.Start())
+
+	store := NewCompositeStore(
+		Layer{Name: "remote", Store: remoteStore},
+		Layer{Name: "overrides", Store: overrideStore},
+	)
+	events := make(chan ChangeEvent, 10)
+	unsubscribe := store.Subscribe(func(evt ChangeEvent) { events <- evt })
+
+	// A change to a flag which is overridden is hidden
+	remote.push(map[string]Flag{"a": boolFlag("no"), "b": boolFlag("yes")})
+	remote.push(map[string]Flag{"a": boolFlag("yes"), "b": boolFlag("yes")})
+	evt := receive(t, events)
+	assert.Equal(t, []string{"a"}, evt.Modified)
+	assert.Equal(t, uint64(4), evt.Generation)
+
+	// Removing an override reveals the flag underneath, which is reported as modified rather than removed
+	remote.push(map[string]Flag{"a": boolFlag("yes"), "b": boolFlag("no")})
+	overrides.push(map[string]Flag{})
+	evt = receive(t, events)
+	assert.Empty(t, evt.Removed)
+	assert.Equal(t, []string{"b"}, evt.Modified)
+	assert.Equal(t, "yes", evt.Old["b"].DefaultVariant)
+	assert.Equal(t, "no", evt.New["b"].DefaultVariant)
+	source, _ := store.Source("b")
+	assert.Equal(t, "remote", source)
+
+	unsubscribe()
+	remote.push(map[string]Flag{})
+	select {
+	case evt := <-events:
+		t.Fatalf("unexpected event after unsubscribing: %+v", evt)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
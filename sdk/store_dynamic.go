@@ -2,10 +2,19 @@ package sdk
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 )
 
+// DefaultHistorySize is how many previous generations a DynamicStore keeps for Rollback,
+// unless WithHistorySize is given.
+const DefaultHistorySize = 10
+
+// ErrStoreClosed is returned by DynamicStore.Start once the store has been closed.
+var ErrStoreClosed = errors.New("dynamic store is closed")
+
 // StoreProvider defines something that can provide and watch a Store (e.g., from file, http, etc.)
 type StoreProvider interface {
 	Load(ctx context.Context) (*Store, error)
@@ -13,20 +22,40 @@ type StoreProvider interface {
 }
 
 // DynamicStore is a AnyStore which wraps a StoreProvider and handles live updates to the internal store.
-// You can call it in the same way you call Store, except you need to call Start first.
+// You can call it in the same way you call Store, once Start has loaded the flags; until then it has no flags.
+// Stop ends the updates (Start may be called again afterward), and Close also ends every subscription.
 type DynamicStore struct {
 	mu          sync.RWMutex
 	store       *Store
 	lastUpdated time.Time
 	source      StoreProvider
 	ctx         context.Context
+	subscribers map[*subscriber[ChangeEvent]]struct{}
+	rejections  map[*subscriber[RejectedReload]]struct{}
+	statuses    map[*subscriber[Status]]struct{}
+	history     []*Store // previous generations, oldest first, for Rollback
+	status      Status
+	rejected    bool        // the source's current flags were rejected, so finding them unchanged is not a success
+	reported    State       // the state last sent to the status subscribers
+	staleTimer  *time.Timer // reports the flags as STALE once they are older than the staleness threshold
+	opts        options
+
+	// lifecycle guards starting and stopping, and is never held while waiting on mu
+	lifecycle sync.Mutex
+	cancel    context.CancelFunc // stops the watcher, nil when not running
+	done      chan struct{}      // closed once the watcher has returned
+	closed    bool               // written with both locks held, so either may be held to read it
+	watching  bool               // guarded by mu, for Status
 }
 
 // NewDynamicStore creates a dynamic flag store that tracks updates from the provider.
-func NewDynamicStore(ctx context.Context, provider StoreProvider) *DynamicStore {
+// The only option it uses itself is WithStalenessThreshold; options for loading flags belong to the provider.
+func NewDynamicStore(ctx context.Context, provider StoreProvider, opts ...Option) *DynamicStore {
 	return &DynamicStore{
-		source: provider,
-		ctx:    ctx,
+		source:   provider,
+		ctx:      ctx,
+		opts:     newOptions(opts),
+		reported: StateNotReady,
 	}
 }
 
@@ -36,38 +65,378 @@ func (d *DynamicStore) LastUpdated() time.Time {
 	return d.lastUpdated
 }
 
-// Start begins watching the underlying source. Should be called once.
+// Start loads the flags and begins watching the underlying source for updates.
+// Calling Start while the store is running does nothing, and it may be called again after Stop.
+// The watcher ends when Stop or Close is called, or when the context given to NewDynamicStore is done, after
+// which the store cannot be started again.
 func (d *DynamicStore) Start() error {
+	d.lifecycle.Lock()
+	defer d.lifecycle.Unlock()
+	if d.closed {
+		return ErrStoreClosed
+	}
+	if d.running() {
+		return nil
+	}
+	d.stop() // the watcher may have ended with the context, leaving it to be cleared up
+	if err := d.ctx.Err(); err != nil {
+		return err
+	}
+
+	if observable, ok := d.source.(ObservableProvider); ok {
+		observable.Observe(storeObserver{d})
+	}
 	initial, err := d.source.Load(d.ctx)
+	d.mu.Lock()
+	if err == nil && initial == nil && d.store == nil {
+		err = errors.New("provider returned no flags")
+	}
 	if err != nil {
+		d.recordFailure(err)
+		d.notifyStatus()
+		d.mu.Unlock()
 		return err
 	}
-	d.store = initial
+	d.mu.Unlock()
+	d.setWatching(true) // first, so the initial load is reported as READY rather than STALE
+	if initial != nil {
+		d.update(initial)
+	} else {
+		// The flags are unchanged since the store was last running
+		storeObserver{d}.ReloadSucceeded()
+	}
+
+	ctx, cancel := context.WithCancel(d.ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.source.Watch(ctx, func(updated *Store) {
+			if updated == nil {
+				return
+			}
+			d.update(updated)
+		})
+		d.setWatching(false) // also when the watcher ends because the context is done, rather than by Stop
+	}()
+	d.cancel, d.done = cancel, done
+
+	return nil
+}
+
+// Stop ends watching the source and waits for the watcher to return, so no updates happen afterward.
+// The last flags loaded are still served, but reported as STALE by Status. Stopping a store which is
+// not running does nothing.
+func (d *DynamicStore) Stop() {
+	d.lifecycle.Lock()
+	defer d.lifecycle.Unlock()
+	d.stop()
+}
+
+// stop ends the watcher. The lifecycle lock must be held.
+func (d *DynamicStore) stop() {
+	if d.cancel == nil {
+		return
+	}
+	d.cancel()
+	<-d.done
+	d.cancel, d.done = nil, nil
+	d.setWatching(false)
+}
+
+func (d *DynamicStore) setWatching(watching bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.watching = watching
+	d.notifyStatus()
+}
+
+// Close stops the store (see Stop) and ends every subscription. A closed store cannot be started again.
+// Closing more than once does nothing.
+func (d *DynamicStore) Close() error {
+	d.lifecycle.Lock()
+	defer d.lifecycle.Unlock()
+	d.stop()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	for sub := range d.subscribers {
+		sub.stop()
+	}
+	for sub := range d.rejections {
+		sub.stop()
+	}
+	for sub := range d.statuses {
+		sub.stop()
+	}
+	d.subscribers, d.rejections, d.statuses = nil, nil, nil
+	if d.staleTimer != nil {
+		d.staleTimer.Stop()
+	}
+	return nil
+}
+
+// Running reports whether the store is watching its source for updates.
+func (d *DynamicStore) Running() bool {
+	d.lifecycle.Lock()
+	defer d.lifecycle.Unlock()
+	return d.running()
+}
+
+// running reports whether the watcher is still going. The lifecycle lock must be held.
+func (d *DynamicStore) running() bool {
+	if d.cancel == nil {
+		return false
+	}
+	select {
+	case <-d.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// update swaps in a store loaded by the provider. Reloads whose flags fail validation are rejected,
+// keeping the current flags; only the first load is accepted regardless, as there is nothing better to serve.
+func (d *DynamicStore) update(updated *Store) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.store != nil && updated.Diagnostics().HasErrors() {
+		d.rejected = true
+		d.rejectReload(updated.Diagnostics().Err(), updated.Diagnostics())
+		return
+	}
+	d.rejected = false
+	d.recordLoad()
+	d.swap(updated, true)
+	d.notifyStatus()
+}
+
+// swap makes a store the current one and tells the subscribers what changed. The lock must be held.
+// The generation only moves on when the flags change, and events are queued while the lock is held,
+// so every subscriber sees updates in order.
+func (d *DynamicStore) swap(updated *Store, keepHistory bool) {
+	var before map[string]Flag
+	var generation uint64
+	if d.store != nil {
+		before = d.store.flags
+		generation = d.store.generation
+	}
+	evt := diffFlags(before, updated.flags)
+	if d.store == nil || !evt.Empty() {
+		generation++
+	}
+	if keepHistory && d.store != nil && !evt.Empty() {
+		d.history = append(d.history, d.store)
+		if size := d.historySize(); len(d.history) > size {
+			d.history = d.history[len(d.history)-size:]
+		}
+	}
+
+	// The provider may share its store, so the generation is set on our own copy
+	snapshot := *updated
+	snapshot.generation = generation
+	d.store = &snapshot
 	d.lastUpdated = time.Now()
 
-	go d.source.Watch(d.ctx, func(updated *Store) {
-		if updated == nil {
+	if evt.Empty() {
+		return
+	}
+	evt.Time = d.lastUpdated
+	evt.Generation = generation
+	for sub := range d.subscribers {
+		sub.publish(evt)
+	}
+}
+
+func (d *DynamicStore) historySize() int {
+	if d.opts.historySize > 0 {
+		return d.opts.historySize
+	}
+	return DefaultHistorySize
+}
+
+// rejectReload records a reload which could not be applied and tells the subscribers. The lock must be held.
+func (d *DynamicStore) rejectReload(err error, diags Diagnostics) {
+	d.recordFailure(err)
+	evt := RejectedReload{Time: d.status.LastErrorAt, Err: err, Diagnostics: diags}
+	for sub := range d.rejections {
+		sub.publish(evt)
+	}
+	d.notifyStatus()
+}
+
+// History returns the previous generations of the flags which Rollback can return to, oldest first.
+func (d *DynamicStore) History() []*Store {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return append([]*Store{}, d.history...)
+}
+
+// Rollback returns to the flags as they were the given number of generations ago (1 is the previous
+// generation), and returns the new snapshot. The flags are applied as a new generation, so snapshot
+// generations never go backwards, and the generations rolled back over are dropped from the history.
+// A rollback lasts until the source next changes.
+func (d *DynamicStore) Rollback(generations int) (*Store, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if generations < 1 || generations > len(d.history) {
+		return nil, fmt.Errorf("cannot roll back %d generations: %d available", generations, len(d.history))
+	}
+	target := d.history[len(d.history)-generations]
+	d.history = d.history[:len(d.history)-generations]
+	d.swap(target, false)
+	return d.store, nil
+}
+
+// recordLoad records a successful load, unless the provider fell back to stale flags. The lock must be held.
+func (d *DynamicStore) recordLoad() {
+	if cached, ok := d.source.(cacheStatuser); ok {
+		if status := cached.Status(); status.Stale() {
+			d.recordFailure(status.Err)
 			return
 		}
-		d.mu.Lock()
-		d.store = updated
-		d.lastUpdated = time.Now()
+	}
+	d.recordSuccess()
+}
+
+// recordSuccess records that the source was loaded or checked. The lock must be held.
+func (d *DynamicStore) recordSuccess() {
+	d.status.LastSuccess = time.Now()
+	d.status.ConsecutiveFailures = 0
+
+	threshold := d.opts.stalenessThreshold
+	if threshold <= 0 || d.closed {
+		return
+	}
+	// A little after the threshold, so the flags are certainly older than it
+	wait := threshold + time.Millisecond
+	if d.staleTimer == nil {
+		d.staleTimer = time.AfterFunc(wait, func() {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			d.notifyStatus()
+		})
+		return
+	}
+	d.staleTimer.Reset(wait)
+}
+
+// recordFailure records that the source could not be loaded. The lock must be held.
+func (d *DynamicStore) recordFailure(err error) {
+	d.status.LastError = err
+	d.status.LastErrorAt = time.Now()
+	d.status.ConsecutiveFailures++
+}
+
+// Status reports the health of the store. It is STALE while reloads are failing or after Stop, and also once
+// the last successful load is older than the WithStalenessThreshold option, if given. Providers which
+// do not implement ObservableProvider only report successful reloads which change the flags.
+func (d *DynamicStore) Status() Status {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.currentStatus()
+}
+
+// currentStatus works out the status for Status. The lock must be held.
+func (d *DynamicStore) currentStatus() Status {
+	status := d.status
+	threshold := d.opts.stalenessThreshold
+	switch {
+	case d.store == nil && status.LastError != nil:
+		status.State = StateError
+	case d.store == nil:
+		status.State = StateNotReady
+	case status.ConsecutiveFailures > 0 || !d.watching:
+		status.State = StateStale
+	case threshold > 0 && time.Since(status.LastSuccess) > threshold:
+		status.State = StateStale
+	default:
+		status.State = StateReady
+	}
+	return status
+}
+
+// notifyStatus tells the status subscribers when the state has changed since they were last told.
+// The lock must be held.
+func (d *DynamicStore) notifyStatus() {
+	status := d.currentStatus()
+	if status.State == d.reported {
+		return
+	}
+	d.reported = status.State
+	for sub := range d.statuses {
+		sub.publish(status)
+	}
+}
+
+// Subscribe registers fn to be called whenever the flags change, including when Start first loads them.
+// Reloads which change nothing are not reported. Each subscriber is called from its own goroutine, one
+// event at a time and in order, so a slow subscriber never delays the store or other subscribers.
+// The returned function unsubscribes; afterward no further events are delivered, although one already
+// being delivered may still complete. Subscriptions also end when the store is closed or its context is done.
+func (d *DynamicStore) Subscribe(fn func(ChangeEvent)) (unsubscribe func()) {
+	return subscribe(d, &d.subscribers, fn)
+}
+
+// SubscribeRejections registers fn to be called whenever a reload is not applied, because the flags
+// failed validation or could not be loaded at all. Delivery follows the same rules as Subscribe.
+func (d *DynamicStore) SubscribeRejections(fn func(RejectedReload)) (unsubscribe func()) {
+	return subscribe(d, &d.rejections, fn)
+}
+
+// SubscribeStatus registers fn to be called whenever the state reported by Status changes, such as from
+// READY to STALE when a reload fails or the staleness threshold passes. Changes before subscribing are not
+// reported, so check Status afterward. Delivery follows the same rules as Subscribe.
+func (d *DynamicStore) SubscribeStatus(fn func(Status)) (unsubscribe func()) {
+	return subscribe(d, &d.statuses, fn)
+}
+
+// subscribe adds a subscriber to one of the store's sets of subscribers
+func subscribe[E any](d *DynamicStore, set *map[*subscriber[E]]struct{}, fn func(E)) func() {
+	sub := newSubscriber(fn)
+
+	d.mu.Lock()
+	if d.closed {
 		d.mu.Unlock()
-	})
+		return func() {}
+	}
+	if *set == nil {
+		*set = make(map[*subscriber[E]]struct{})
+	}
+	(*set)[sub] = struct{}{}
+	d.mu.Unlock()
 
-	return nil
+	go sub.run(d.ctx)
+
+	return func() {
+		d.mu.Lock()
+		delete(*set, sub)
+		d.mu.Unlock()
+		sub.stop()
+	}
 }
 
-// Get retrieves an un-evaluated flag, ready for evaluation.
+// Get retrieves an un-evaluated flag, ready for evaluation. Before Start there are no flags.
 func (d *DynamicStore) Get(key string) (Flag, bool) {
+	return d.Snapshot().Get(key)
+}
+
+// Snapshot returns the current flags as a Store which is unaffected by later updates, so that every flag
+// evaluated in a unit of work (such as a request) comes from the same generation.
+// Before Start it returns an empty store of generation 0.
+func (d *DynamicStore) Snapshot() *Store {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
-	return d.store.Get(key)
+	if d.store == nil {
+		return &Store{flags: map[string]Flag{}}
+	}
+	return d.store
 }
 
-// AllFlags returns all current flag definitions.
+// AllFlags returns all current flag definitions, which are empty before Start.
 func (d *DynamicStore) AllFlags() map[string]Flag {
-	d.mu.RLock()
-	defer d.mu.RUnlock()
-	return d.store.AllFlags()
+	return d.Snapshot().AllFlags()
 }
@@ -0,0 +1,577 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tommed/ducto-featureflags/test"
+)
+
+// chanProvider is a StoreProvider whose updates are pushed by the test
+type chanProvider struct {
+	initial *Store
+	updates chan *Store
+}
+
+func newChanProvider(flags map[string]Flag) *chanProvider {
+	return &chanProvider{initial: newStore(flags, options{}), updates: make(chan *Store)}
+}
+
+func (p *chanProvider) Load(_ context.Context) (*Store, error) {
+	return p.initial, nil
+}
+
+func (p *chanProvider) Watch(ctx context.Context, onChange func(*Store)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case store := <-p.updates:
+			onChange(store)
+		}
+	}
+}
+
+func (p *chanProvider) push(flags map[string]Flag) {
+	p.updates <- newStore(flags, options{})
+}
+
+func boolFlag(defaultVariant string) Flag {
+	return Flag{Variants: test.BoolVariants(), DefaultVariant: defaultVariant}
+}
+
+func receive(t *testing.T, events <-chan ChangeEvent) ChangeEvent {
+	t.Helper()
+	select {
+	case evt := <-events:
+		return evt
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a change event")
+		return ChangeEvent{}
+	}
+}
+
+func TestDynamicStore_Subscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	provider := newChanProvider(map[string]Flag{
+		"keep":   boolFlag("yes"),
+		"change": boolFlag("no"),
+		"remove": boolFlag("no"),
+	})
+	store := NewDynamicStore(ctx, provider)
+
+	events := make(chan ChangeEvent, 10)
+	store.Subscribe(func(evt ChangeEvent) { events <- evt })
+	require.NoError(t, store.Start())
+
+	// The initial load adds every flag
+	evt := receive(t, events)
+	assert.Equal(t, []string{"change", "keep", "remove"}, evt.Added)
+	assert.Empty(t, evt.Removed)
+	assert.Empty(t, evt.Modified)
+	assert.False(t, evt.Time.IsZero())
+
+	provider.push(map[string]Flag{
+		"keep":   boolFlag("yes"),
+		"change": boolFlag("yes"),
+		"new":    boolFlag("no"),
+	})
+	evt = receive(t, events)
+	assert.Equal(t, []string{"new"}, evt.Added)
+	assert.Equal(t, []string{"remove"}, evt.Removed)
+	assert.Equal(t, []string{"change"}, evt.Modified)
+	assert.Equal(t, []string{"change", "new", "remove"}, evt.Keys())
+	assert.Equal(t, "no", evt.Old["change"].DefaultVariant)
+	assert.Equal(t, "yes", evt.New["change"].DefaultVariant)
+	assert.Contains(t, evt.Old, "remove")
+	assert.NotContains(t, evt.New, "remove")
+	assert.Contains(t, evt.New, "new")
+	assert.NotContains(t, evt.Old, "keep")
+
+	// A reload which changes nothing is not reported
+	provider.push(map[string]Flag{
+		"keep":   boolFlag("yes"),
+		"change": boolFlag("yes"),
+		"new":    boolFlag("no"),
+	})
+	provider.push(map[string]Flag{"keep": boolFlag("no")})
+	evt = receive(t, events)
+	assert.Equal(t, []string{"keep"}, evt.Modified)
+}
+
+func TestDynamicStore_SubscribeDoesNotBlock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	provider := newChanProvider(map[string]Flag{"a": boolFlag("no")})
+	store := NewDynamicStore(ctx, provider)
+	require.NoError(t, store.Start())
+
+	// A subscriber which never returns must not hold up updates or other subscribers
+	blocked := make(chan struct{})
+	defer close(blocked)
+	store.Subscribe(func(ChangeEvent) { <-blocked })
+
+	var seen []string
+	events := make(chan ChangeEvent, 10)
+	store.Subscribe(func(evt ChangeEvent) { events <- evt })
+
+	for _, variant := range []string{"yes", "no", "yes"} {
+		provider.push(map[string]Flag{"a": boolFlag(variant)})
+	}
+	for i := 0; i < 3; i++ {
+		seen = append(seen, receive(t, events).New["a"].DefaultVariant)
+	}
+	assert.Equal(t, []string{"yes", "no", "yes"}, seen, "events are delivered in order")
+
+	flag, ok := store.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "yes", flag.DefaultVariant)
+}
+
+func TestDynamicStore_Unsubscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	provider := newChanProvider(map[string]Flag{"a": boolFlag("no")})
+	store := NewDynamicStore(ctx, provider)
+	require.NoError(t, store.Start())
+
+	unsubscribed := make(chan ChangeEvent, 10)
+	unsubscribe := store.Subscribe(func(evt ChangeEvent) { unsubscribed <- evt })
+	events := make(chan ChangeEvent, 10)
+	store.Subscribe(func(evt ChangeEvent) { events <- evt })
+
+	unsubscribe()
+	unsubscribe() // safe to call twice
+
+	provider.push(map[string]Flag{"a": boolFlag("yes")})
+	receive(t, events)
+	assert.Empty(t, unsubscribed)
+}
+
+func TestDynamicStore_Snapshot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	provider := newChanProvider(map[string]Flag{"a": boolFlag("no"), "b": boolFlag("no")})
+	store := NewDynamicStore(ctx, provider)
+
+	empty := store.Snapshot()
+	assert.Equal(t, uint64(0), empty.Generation())
+	assert.Empty(t, empty.AllFlags())
+
+	events := make(chan ChangeEvent, 10)
+	store.Subscribe(func(evt ChangeEvent) { events <- evt })
+	require.NoError(t, store.Start())
+	assert.Equal(t, uint64(1), receive(t, events).Generation)
+
+	snapshot := store.Snapshot()
+	assert.Equal(t, uint64(1), snapshot.Generation())
+
+	provider.push(map[string]Flag{"a": boolFlag("yes"), "b": boolFlag("yes")})
+	assert.Equal(t, uint64(2), receive(t, events).Generation)
+
+	// The snapshot still sees every flag as it was
+	for _, key := range []string{"a", "b"} {
+		result, ok := snapshot.Evaluate(key, nil)
+		assert.True(t, ok)
+		assert.Equal(t, false, result.Value)
+		assert.Equal(t, uint64(1), result.Generation)
+	}
+
+	latest := store.Snapshot()
+	result, ok := latest.Evaluate("a", nil)
+	assert.True(t, ok)
+	assert.Equal(t, true, result.Value)
+	assert.Equal(t, uint64(2), result.Generation)
+
+	// A reload which changes nothing keeps the generation
+	provider.push(map[string]Flag{"a": boolFlag("yes"), "b": boolFlag("yes")})
+	provider.push(map[string]Flag{"a": boolFlag("no")})
+	assert.Equal(t, uint64(3), receive(t, events).Generation)
+	assert.Equal(t, uint64(3), store.Snapshot().Generation())
+}
+
+// Run with -race: readers evaluate, list and mutate what they are given while the store reloads
+func TestDynamicStore_ConcurrentReadsDuringReloads(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	flags := func(variant string) map[string]Flag {
+		return map[string]Flag{
+			"a": {Variants: test.BoolVariants(), DefaultVariant: variant, Tags: []string{"ui"},
+				Rules: []VariantRule{{If: map[string]string{"env": "prod"}, Variant: "yes"}}},
+			"b": boolFlag(variant),
+		}
+	}
+	provider := newChanProvider(flags("no"))
+	store := NewDynamicStore(ctx, provider)
+	require.NoError(t, store.Start())
+	store.Subscribe(func(evt ChangeEvent) {
+		for _, f := range evt.New {
+			f.Variants["changed"] = true
+		}
+	})
+
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				snapshot := store.Snapshot()
+				a, _ := snapshot.Evaluate("a", EvalContext{"env": "prod"})
+				b, _ := snapshot.Evaluate("b", EvalContext{})
+				assert.Equal(t, a.Generation, b.Generation)
+
+				f, _ := store.Get("a")
+				f.Tags[0] = "mutated"
+				f.Rules[0].If["env"] = "mutated"
+				for key, flag := range store.AllFlags() {
+					flag.Variants[key] = key
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 50; i++ {
+		if i%2 == 0 {
+			provider.push(flags("yes"))
+		} else {
+			provider.push(flags("no"))
+		}
+	}
+	close(done)
+	readers.Wait()
+
+	f, _ := store.Get("a")
+	assert.Equal(t, []string{"ui"}, f.Tags)
+	assert.Equal(t, map[string]string{"env": "prod"}, f.Rules[0].If)
+	assert.Len(t, f.Variants, 2)
+}
+
+// observableProvider is a chanProvider which reports reload outcomes like a polling provider
+type observableProvider struct {
+	*chanProvider
+	observed
+}
+
+func TestDynamicStore_Status(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	provider := &observableProvider{chanProvider: newChanProvider(map[string]Flag{"a": boolFlag("no")})}
+	store := NewDynamicStore(ctx, provider)
+	assert.Equal(t, StateNotReady, store.Status().State)
+
+	require.NoError(t, store.Start())
+	status := store.Status()
+	assert.Equal(t, StateReady, status.State)
+	assert.WithinDuration(t, time.Now(), status.LastSuccess, time.Second)
+	assert.NoError(t, status.LastError)
+
+	provider.reloadFailed(errors.New("timeout"))
+	provider.reloadFailed(errors.New("connection refused"))
+	status = store.Status()
+	assert.Equal(t, StateStale, status.State)
+	assert.Equal(t, 2, status.ConsecutiveFailures)
+	assert.EqualError(t, status.LastError, "connection refused")
+	assert.False(t, status.LastErrorAt.IsZero())
+
+	// Finding nothing has changed counts as a success
+	provider.reloadSucceeded()
+	status = store.Status()
+	assert.Equal(t, StateReady, status.State)
+	assert.Equal(t, 0, status.ConsecutiveFailures)
+	assert.EqualError(t, status.LastError, "connection refused", "the last error is kept for diagnosis")
+}
+
+func TestDynamicStore_StatusError(t *testing.T) {
+	store := NewDynamicStore(context.Background(), failingProvider{})
+	assert.Error(t, store.Start())
+	status := store.Status()
+	assert.Equal(t, StateError, status.State)
+	assert.Equal(t, 1, status.ConsecutiveFailures)
+	assert.ErrorContains(t, status.LastError, "connection refused")
+}
+
+func TestDynamicStore_StatusStalenessThreshold(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := NewDynamicStore(ctx, newChanProvider(map[string]Flag{}), WithStalenessThreshold(50*time.Millisecond))
+	require.NoError(t, store.Start())
+	assert.Equal(t, StateReady, store.Status().State)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, StateStale, store.Status().State)
+}
+
+func TestDynamicStore_StatusFromCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	provider := NewCachingProvider(failingProvider{}, filepath.Join(t.TempDir(), "cache.json"),
+		WithDefaultFlags([]byte(`{}`), "json"))
+	store := NewDynamicStore(ctx, provider)
+	require.NoError(t, store.Start())
+
+	status := store.Status()
+	assert.Equal(t, StateStale, status.State, "flags served from defaults are stale")
+	assert.ErrorContains(t, status.LastError, "connection refused")
+}
+
+func TestDynamicStore_SubscribeStatus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	provider := &observableProvider{chanProvider: newChanProvider(map[string]Flag{})}
+	store := NewDynamicStore(ctx, provider, WithStalenessThreshold(100*time.Millisecond))
+	statuses := make(chan Status, 10)
+	store.SubscribeStatus(func(status Status) { statuses <- status })
+	next := func() State {
+		t.Helper()
+		select {
+		case status := <-statuses:
+			return status.State
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for a status change")
+			return ""
+		}
+	}
+
+	require.NoError(t, store.Start())
+	assert.Equal(t, StateReady, next())
+
+	// Only changes of state are reported
+	provider.reloadFailed(errors.New("timeout"))
+	provider.reloadFailed(errors.New("timeout"))
+	assert.Equal(t, StateStale, next())
+	provider.reloadSucceeded()
+	assert.Equal(t, StateReady, next())
+
+	// With no reloads, the flags go stale once they are older than the threshold
+	assert.Equal(t, StateStale, next())
+	provider.reloadSucceeded()
+	assert.Equal(t, StateReady, next())
+
+	store.Stop()
+	assert.Equal(t, StateStale, next())
+	select {
+	case status := <-statuses:
+		t.Fatalf("unexpected status change to %s", status.State)
+	default:
+	}
+}
+
+// countingProvider counts how many watchers are running
+type countingProvider struct {
+	*chanProvider
+	watchers atomic.Int32
+}
+
+func (p *countingProvider) Watch(ctx context.Context, onChange func(*Store)) {
+	p.watchers.Add(1)
+	defer p.watchers.Add(-1)
+	p.chanProvider.Watch(ctx, onChange)
+}
+
+// tryPush offers an update, reporting whether a watcher took it
+func (p *chanProvider) tryPush(flags map[string]Flag) bool {
+	select {
+	case p.updates <- newStore(flags, options{}):
+		return true
+	case <-time.After(100 * time.Millisecond):
+		return false
+	}
+}
+
+func TestDynamicStore_BeforeStart(t *testing.T) {
+	store := NewDynamicStore(context.Background(), newChanProvider(map[string]Flag{"a": boolFlag("no")}))
+	_, ok := store.Get("a")
+	assert.False(t, ok)
+	assert.Empty(t, store.AllFlags())
+	assert.False(t, store.Running())
+	store.Stop() // nothing to stop
+}
+
+func TestDynamicStore_Lifecycle(t *testing.T) {
+	provider := &countingProvider{chanProvider: newChanProvider(map[string]Flag{"a": boolFlag("no")})}
+	store := NewDynamicStore(context.Background(), provider)
+
+	require.NoError(t, store.Start())
+	require.NoError(t, store.Start(), "starting again does nothing")
+	assert.True(t, store.Running())
+	assert.Eventually(t, func() bool { return provider.watchers.Load() == 1 }, time.Second, 10*time.Millisecond)
+	assert.True(t, provider.tryPush(map[string]Flag{"a": boolFlag("yes")}))
+
+	// Once stopped, the watcher has gone and the last flags are still served
+	store.Stop()
+	assert.False(t, store.Running())
+	assert.Equal(t, int32(0), provider.watchers.Load())
+	assert.False(t, provider.tryPush(map[string]Flag{}))
+	f, ok := store.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "yes", f.DefaultVariant)
+	assert.Equal(t, StateStale, store.Status().State)
+	store.Stop() // stopping twice is fine
+
+	// Restarting loads the flags again and resumes watching
+	require.NoError(t, store.Start())
+	assert.Equal(t, StateReady, store.Status().State)
+	f, _ = store.Get("a")
+	assert.Equal(t, "no", f.DefaultVariant)
+	assert.True(t, provider.tryPush(map[string]Flag{}))
+
+	// Closing stops the store for good and ends the subscriptions
+	events := make(chan ChangeEvent, 10)
+	store.Subscribe(func(evt ChangeEvent) { events <- evt })
+	require.NoError(t, store.Close())
+	require.NoError(t, store.Close())
+	assert.Equal(t, int32(0), provider.watchers.Load())
+	assert.ErrorIs(t, store.Start(), ErrStoreClosed)
+	store.Subscribe(func(evt ChangeEvent) { events <- evt })()
+	assert.Empty(t, events)
+}
+
+func TestDynamicStore_ContextEnds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	provider := &countingProvider{chanProvider: newChanProvider(map[string]Flag{"a": boolFlag("no")})}
+	store := NewDynamicStore(ctx, provider)
+	require.NoError(t, store.Start())
+	assert.Eventually(t, func() bool { return provider.watchers.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	// Once the context ends, the store is no longer watching, so says so rather than reporting READY
+	cancel()
+	assert.Eventually(t, func() bool { return !store.Running() }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, StateStale, store.Status().State)
+	f, ok := store.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "no", f.DefaultVariant)
+
+	// Starting again tries, rather than doing nothing
+	assert.ErrorIs(t, store.Start(), context.Canceled)
+	assert.False(t, store.Running())
+	store.Stop()
+}
+
+func TestDynamicStore_RejectsInvalidReloads(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	provider := &observableProvider{chanProvider: newChanProvider(map[string]Flag{"a": boolFlag("no")})}
+	store := NewDynamicStore(ctx, provider)
+	require.NoError(t, store.Start())
+
+	rejections := make(chan RejectedReload, 10)
+	store.SubscribeRejections(func(r RejectedReload) { rejections <- r })
+	changes := make(chan ChangeEvent, 10)
+	store.Subscribe(func(evt ChangeEvent) { changes <- evt })
+
+	// These flags parse, but refer to a variant which does not exist
+	provider.push(map[string]Flag{"a": boolFlag("maybe")})
+	var rejected RejectedReload
+	select {
+	case rejected = <-rejections:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a rejection")
+	}
+	assert.ErrorContains(t, rejected.Err, "invalid flags")
+	require.Len(t, rejected.Diagnostics.Errors(), 1)
+	assert.Equal(t, "a", rejected.Diagnostics[0].FlagKey)
+	assert.False(t, rejected.Time.IsZero())
+
+	f, _ := store.Get("a")
+	assert.Equal(t, "no", f.DefaultVariant, "the previous flags are kept")
+	assert.Equal(t, uint64(1), store.Snapshot().Generation())
+	assert.Equal(t, StateStale, store.Status().State)
+	assert.Empty(t, changes)
+
+	// The provider finding its source unchanged does not hide the rejection, as the source is still invalid
+	provider.reloadSucceeded()
+	status := store.Status()
+	assert.Equal(t, StateStale, status.State)
+	assert.Equal(t, 1, status.ConsecutiveFailures)
+
+	// Failures reported by the provider are rejections too
+	provider.reloadFailed((Diagnostics{{Severity: SeverityError, FlagKey: "b", RuleIndex: -1, Message: "bad"}}).Err())
+	provider.reloadFailed(errors.New("connection refused"))
+	rejected = <-rejections
+	assert.Len(t, rejected.Diagnostics, 1)
+	rejected = <-rejections
+	assert.EqualError(t, rejected.Err, "connection refused")
+	assert.Nil(t, rejected.Diagnostics)
+
+	// A valid reload is applied as usual, after which unchanged checks are successes again
+	provider.push(map[string]Flag{"a": boolFlag("yes")})
+	receive(t, changes)
+	assert.Equal(t, StateReady, store.Status().State)
+	provider.reloadFailed(errors.New("timeout"))
+	provider.reloadSucceeded()
+	assert.Equal(t, StateReady, store.Status().State)
+}
+
+func TestDynamicStore_Rollback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	provider := newChanProvider(map[string]Flag{"a": boolFlag("v1")})
+	store := NewDynamicStore(ctx, provider, WithHistorySize(3))
+	require.NoError(t, store.Start())
+
+	_, err := store.Rollback(1)
+	assert.EqualError(t, err, "cannot roll back 1 generations: 0 available")
+
+	changes := make(chan ChangeEvent, 10)
+	store.Subscribe(func(evt ChangeEvent) { changes <- evt })
+	variants := func(v string) map[string]Flag {
+		return map[string]Flag{"a": {Variants: map[string]interface{}{v: true}, DefaultVariant: v}}
+	}
+	for _, v := range []string{"v2", "v3", "v4", "v5"} {
+		provider.push(variants(v))
+		receive(t, changes)
+	}
+
+	// Only the last three previous generations are kept
+	history := store.History()
+	require.Len(t, history, 3)
+	assert.Equal(t, []uint64{2, 3, 4}, []uint64{history[0].Generation(), history[1].Generation(), history[2].Generation()})
+
+	snapshot, err := store.Rollback(2)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(6), snapshot.Generation(), "a rollback is a new generation")
+	f, _ := store.Get("a")
+	assert.Equal(t, "v3", f.DefaultVariant)
+	evt := receive(t, changes)
+	assert.Equal(t, []string{"a"}, evt.Modified)
+	assert.Equal(t, "v5", evt.Old["a"].DefaultVariant)
+	assert.Equal(t, "v3", evt.New["a"].DefaultVariant)
+
+	require.Len(t, store.History(), 1)
+	_, err = store.Rollback(2)
+	assert.Error(t, err)
+	_, err = store.Rollback(0)
+	assert.Error(t, err)
+
+	_, err = store.Rollback(1)
+	require.NoError(t, err)
+	f, _ = store.Get("a")
+	assert.Equal(t, "v2", f.DefaultVariant)
+	assert.Empty(t, store.History())
+}
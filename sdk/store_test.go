@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -101,3 +102,88 @@ func TestAllFlags(t *testing.T) {
 	assert.True(t, yVal.OK)
 	assert.Equal(t, false, yVal.Value.(bool))
 }
+
+func TestStore_Evaluate(t *testing.T) {
+	store := NewStore(map[string]Flag{
+		"a": {Variants: test.BoolVariants(), DefaultVariant: "yes"},
+	})
+
+	snapshot := store.Snapshot()
+	assert.Same(t, store, snapshot)
+	assert.Equal(t, uint64(1), snapshot.Generation())
+
+	result, ok := snapshot.Evaluate("a", EvalContext{})
+	assert.True(t, ok)
+	assert.Equal(t, EvaluationResult{Variant: "yes", Value: true, OK: true, Generation: 1}, result)
+
+	result, ok = snapshot.Evaluate("missing", EvalContext{})
+	assert.False(t, ok)
+	assert.False(t, result.OK)
+}
+
+func TestStore_OwnsItsFlags(t *testing.T) {
+	percent := 50
+	flags := map[string]Flag{
+		"a": {
+			Variants:       map[string]interface{}{"on": map[string]interface{}{"colours": []interface{}{"red"}}},
+			DefaultVariant: "on",
+			Rules:          []VariantRule{{If: map[string]string{"env": "prod"}, Variant: "on", Percent: &percent, Seed: "user"}},
+			Tags:           []string{"ui"},
+		},
+	}
+	store := NewStore(flags)
+
+	// Changing the caller's map after the store is created has no effect
+	flags["a"].Variants["on"].(map[string]interface{})["colours"].([]interface{})[0] = "blue"
+	flags["a"].Rules[0].If["env"] = "dev"
+	percent = 10
+	flags["b"] = Flag{}
+
+	// Nor does changing anything the store hands out
+	got, _ := store.Get("a")
+	got.Tags[0] = "api"
+	got.Variants["off"] = false
+	all := store.AllFlags()
+	all["a"].Rules[0].If["region"] = "eu"
+	delete(all, "a")
+	result, _ := store.Snapshot().Evaluate("a", EvalContext{})
+	result.Value.(map[string]interface{})["colours"].([]interface{})[0] = "green"
+
+	got, ok := store.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"on": map[string]interface{}{"colours": []interface{}{"red"}}}, got.Variants)
+	assert.Equal(t, map[string]string{"env": "prod"}, got.Rules[0].If)
+	assert.Equal(t, 50, *got.Rules[0].Percent)
+	assert.Equal(t, []string{"ui"}, got.Tags)
+	assert.Len(t, store.AllFlags(), 1)
+	result, _ = store.Snapshot().Evaluate("a", EvalContext{})
+	assert.Equal(t, map[string]interface{}{"colours": []interface{}{"red"}}, result.Value)
+}
+
+func TestFlag_Clone(t *testing.T) {
+	disabled := true
+	now := time.Now()
+	flag := Flag{
+		Variants:     test.BoolVariants(),
+		Schema:       map[string]interface{}{"type": "boolean"},
+		Metadata:     map[string]interface{}{"ticket": []interface{}{"ABC-1"}},
+		CreatedAt:    &now,
+		ExpiresAt:    &now,
+		Environments: map[string]EnvironmentOverride{"prod": {Disabled: &disabled, Rules: []VariantRule{{Variant: "yes"}}}},
+	}
+	clone := flag.Clone()
+	assert.Equal(t, flag, clone)
+
+	clone.Schema["type"] = "string"
+	clone.Metadata["ticket"].([]interface{})[0] = "XYZ-9"
+	*clone.CreatedAt = now.Add(time.Hour)
+	*clone.Environments["prod"].Disabled = false
+	clone.Environments["prod"].Rules[0].Variant = "no"
+
+	assert.Equal(t, "boolean", flag.Schema["type"])
+	assert.Equal(t, "ABC-1", flag.Metadata["ticket"].([]interface{})[0])
+	assert.Equal(t, now, *flag.CreatedAt)
+	assert.True(t, *flag.Environments["prod"].Disabled)
+	assert.Equal(t, "yes", flag.Environments["prod"].Rules[0].Variant)
+	assert.Nil(t, Flag{}.Clone().Rules)
+}
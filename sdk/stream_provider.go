@@ -0,0 +1,250 @@
+package sdk
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The events of a flag stream, such as the /api/stream endpoint of the serve command, which is sent as
+// Server-Sent Events. Each event's ID identifies the generation of flags it brings the client up to, and is
+// sent back as Last-Event-ID on reconnection so that the server can send only what was missed.
+const (
+	StreamEventSnapshot = "snapshot" // every flag
+	StreamEventDelta    = "delta"    // the flags added, modified or removed by one change
+)
+
+// StreamEvent is the data of a snapshot or delta event on a flag stream.
+type StreamEvent struct {
+	Generation uint64          `json:"generation"`
+	Flags      map[string]Flag `json:"flags,omitempty"`   // every flag, or for a delta those added or modified
+	Removed    []string        `json:"removed,omitempty"` // for a delta, the keys of the flags removed
+}
+
+// streamEvent is a StreamEvent as received, so the flags can be decoded in the same way as a flag file
+type streamEvent struct {
+	Generation uint64                     `json:"generation"`
+	Flags      map[string]json.RawMessage `json:"flags,omitempty"`
+	Removed    []string                   `json:"removed,omitempty"`
+}
+
+// maxStreamEventSize is the largest event accepted from a flag stream
+const maxStreamEventSize = 16 << 20
+
+// errStreamUnsupported means the server has no flag stream, so it has to be polled instead
+var errStreamUnsupported = errors.New("server does not support streaming")
+
+// errStreamOutOfSync means an event could not be applied, so later deltas cannot be either, and the stream has
+// to be reconnected to for a snapshot
+var errStreamOutOfSync = errors.New("lost track of the flags")
+
+// NewStreamProvider creates a provider which receives changes to the flags as soon as they happen, from a flag
+// stream at streamURL (such as the /api/stream endpoint of the serve command). The flags are first loaded from
+// pollURL, as by NewHTTPProvider. When the stream is interrupted it reconnects with the backoff of WithBackoff,
+// resuming from the last event received; when the server has no stream, pollURL is polled at the interval instead.
+// The HTTP and TLS options of NewHTTPProvider apply to both, except WithHTTPTimeout which only applies to polls.
+func NewStreamProvider(streamURL, pollURL, token string, interval time.Duration, opts ...Option) StoreProvider {
+	return &streamProvider{
+		url:    streamURL,
+		token:  token,
+		opts:   opts,
+		poller: &httpProvider{URL: pollURL, Token: token, Interval: pollInterval(interval), opts: opts},
+	}
+}
+
+// streamProvider implements StoreProvider by listening to a flag stream.
+type streamProvider struct {
+	url    string
+	token  string
+	opts   []Option
+	poller *httpProvider
+	observed
+
+	// Only used by the goroutine running Watch
+	lastID string
+	flags  map[string]json.RawMessage
+}
+
+// Load loads the flags by polling once.
+func (p *streamProvider) Load(ctx context.Context) (*Store, error) {
+	return p.poller.Load(ctx)
+}
+
+// Observe registers the observer for both the stream and the fallback to polling.
+func (p *streamProvider) Observe(observer ProviderObserver) {
+	p.observed.Observe(observer)
+	p.poller.Observe(observer)
+}
+
+// Watch listens to the stream until the context is done, reconnecting whenever it is interrupted.
+func (p *streamProvider) Watch(ctx context.Context, onChange func(*Store)) {
+	o := newOptions(p.opts)
+	failures := 0
+	for {
+		received, err := p.listen(ctx, o, onChange)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errStreamUnsupported) {
+			p.poller.Watch(ctx, onChange)
+			return
+		}
+		if received {
+			failures = 0
+		}
+		failures++
+		p.reloadFailed(fmt.Errorf("flag stream: %w", err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.poller.nextDelay(o, failures)):
+		}
+	}
+}
+
+// listen connects to the stream and applies its events until it ends, reporting whether any were received
+func (p *streamProvider) listen(ctx context.Context, o options, onChange func(*Store)) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.url, nil)
+	if err != nil {
+		return false, err
+	}
+	for key, values := range o.httpHeaders {
+		req.Header[key] = append([]string{}, values...)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	if p.lastID != "" {
+		req.Header.Set("Last-Event-ID", p.lastID)
+	}
+
+	client, err := p.poller.httpClient(o)
+	if err != nil {
+		return false, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+
+	//goland:noinspection GoUnhandledErrorResult
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotAcceptable, http.StatusNotImplemented:
+		return false, errStreamUnsupported
+	}
+	if resp.StatusCode >= 400 {
+		return false, fmt.Errorf("http error: %s", resp.Status)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/event-stream" {
+		return false, errStreamUnsupported
+	}
+
+	received := false
+	err = readEvents(resp.Body, func(id, name string, data []byte) error {
+		received = true
+		store, err := p.apply(name, data, o)
+		if errors.Is(err, errStreamOutOfSync) {
+			p.lastID, p.flags = "", nil // so the server sends every flag again
+			return err
+		}
+		if id != "" {
+			p.lastID = id
+		}
+		if err != nil {
+			p.reloadFailed(fmt.Errorf("flag stream: %w", err))
+			return nil
+		}
+		if store != nil {
+			onChange(store)
+		}
+		return nil
+	})
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return received, err
+}
+
+// apply updates the flags with an event, returning the resulting store, or nil for events which are not understood.
+// The flags are kept in step with the server even when they do not make a valid store, so later deltas apply to
+// them; when an event cannot be applied at all, the error is errStreamOutOfSync.
+func (p *streamProvider) apply(name string, data []byte, o options) (*Store, error) {
+	if name != StreamEventSnapshot && name != StreamEventDelta {
+		return nil, nil
+	}
+	var evt streamEvent
+	if err := json.Unmarshal(data, &evt); err != nil {
+		return nil, fmt.Errorf("%w: parse %s event: %v", errStreamOutOfSync, name, err)
+	}
+
+	flags := make(map[string]json.RawMessage)
+	if name == StreamEventDelta {
+		if p.flags == nil {
+			return nil, fmt.Errorf("%w: received a delta before any snapshot", errStreamOutOfSync)
+		}
+		for key, f := range p.flags {
+			flags[key] = f
+		}
+		for _, key := range evt.Removed {
+			delete(flags, key)
+		}
+	}
+	for key, f := range evt.Flags {
+		flags[key] = f
+	}
+	p.flags = flags
+
+	// The flags are decoded and validated in the same way as a flag file, to be sure they are loaded identically
+	doc, err := json.Marshal(map[string]interface{}{"$schemaVersion": CurrentSchemaVersion, "flags": flags})
+	if err != nil {
+		return nil, err
+	}
+	return NewStoreFromBytesWithFormat(doc, "json", p.opts...)
+}
+
+// readEvents parses Server-Sent Events, calling fn with each one until the stream ends or fails, or fn fails
+func readEvents(r io.Reader, fn func(id, name string, data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamEventSize)
+
+	var id, name string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(data) > 0 {
+				if err := fn(id, name, []byte(strings.Join(data, "\n"))); err != nil {
+					return err
+				}
+			}
+			id, name, data = "", "", nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue // a comment, such as a heartbeat
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			name = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,153 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStream is a flag stream which sends the events given to it, one connection at a time
+type fakeStream struct {
+	events      chan string
+	mu          sync.Mutex
+	lastEventID []string // the Last-Event-ID of each connection
+	active      atomic.Int32
+}
+
+func (s *fakeStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.lastEventID = append(s.lastEventID, r.Header.Get("Last-Event-ID"))
+	s.mu.Unlock()
+	s.active.Add(1)
+	defer s.active.Add(-1)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.(http.Flusher).Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case evt, open := <-s.events:
+			if !open || evt == "" { // drop the connection
+				return
+			}
+			_, _ = fmt.Fprint(w, evt)
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+func (s *fakeStream) connections() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.lastEventID...)
+}
+
+func sse(id, name, data string) string {
+	return fmt.Sprintf("id: %s\nevent: %s\ndata: %s\n\n", id, name, data)
+}
+
+func TestReadEvents(t *testing.T) {
+	input := ": a comment\n" +
+		"id: 1\nevent: snapshot\ndata: {\"a\":\ndata: 1}\n\n" +
+		"event: ignored\n\n" +
+		"data:no space\n\n"
+	type event struct{ id, name, data string }
+	var events []event
+	err := readEvents(strings.NewReader(input), func(id, name string, data []byte) error {
+		events = append(events, event{id, name, string(data)})
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []event{{"1", "snapshot", "{\"a\":\n1}"}, {"", "", "no space"}}, events)
+}
+
+func TestStreamProvider_SnapshotsAndDeltas(t *testing.T) {
+	stream := &fakeStream{events: make(chan string, 10)}
+	mux := http.NewServeMux()
+	mux.Handle("/stream", stream)
+	mux.HandleFunc("/flags", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{ "a": ` + boolFlagJSON("no") + ` }`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := NewDynamicStore(ctx, NewStreamProvider(server.URL+"/stream", server.URL+"/flags", "", time.Hour,
+		WithBackoff(10*time.Millisecond, 50*time.Millisecond)))
+	require.NoError(t, store.Start())
+	defer store.Close()
+	changes := make(chan ChangeEvent, 10)
+	store.Subscribe(func(evt ChangeEvent) { changes <- evt })
+
+	f, _ := store.Get("a")
+	assert.Equal(t, "no", f.DefaultVariant, "loaded by polling")
+
+	stream.events <- sse("x-1", StreamEventSnapshot, `{"generation":1,"flags":{"a":`+boolFlagJSON("yes")+`}}`)
+	assert.Equal(t, []string{"a"}, receive(t, changes).Modified)
+
+	stream.events <- sse("x-2", StreamEventDelta, `{"generation":2,"flags":{"b":`+boolFlagJSON("no")+`}}`)
+	assert.Equal(t, []string{"b"}, receive(t, changes).Added)
+
+	// After the connection drops, the stream resumes from the last event
+	stream.events <- ""
+	stream.events <- sse("x-3", StreamEventDelta, `{"generation":3,"removed":["a"]}`)
+	assert.Equal(t, []string{"a"}, receive(t, changes).Removed)
+	assert.Equal(t, []string{"", "x-2"}, stream.connections())
+	assert.Equal(t, []string{"b"}, sortedKeys(store.AllFlags()))
+
+	// Flags which do not load are rejected, but later deltas still apply to them, as they do on the server
+	stream.events <- sse("x-4", StreamEventDelta, `{"generation":4,"flags":{"b":`+boolFlagJSON("yes")+`,"c":{"variants":5}}}`)
+	require.Eventually(t, func() bool { return store.Status().LastError != nil }, time.Second, 10*time.Millisecond)
+	stream.events <- sse("x-5", StreamEventDelta, `{"generation":5,"removed":["c"]}`)
+	assert.Equal(t, []string{"b"}, receive(t, changes).Modified)
+	f, _ = store.Get("b")
+	assert.Equal(t, "yes", f.DefaultVariant)
+
+	// An event which cannot be applied at all is reported, and the stream is reconnected to for a snapshot
+	stream.events <- sse("x-6", StreamEventDelta, `{ BROKEN`)
+	require.Eventually(t, func() bool { return len(stream.connections()) == 3 && stream.active.Load() == 1 },
+		time.Second, 10*time.Millisecond, "the old connection is closed")
+	assert.Equal(t, "", stream.connections()[2])
+	assert.ErrorContains(t, store.Status().LastError, "parse delta event")
+	stream.events <- sse("x-7", StreamEventSnapshot, `{"generation":7,"flags":{"d":`+boolFlagJSON("no")+`}}`)
+	change := receive(t, changes)
+	assert.Equal(t, []string{"d"}, change.Added)
+	assert.Equal(t, []string{"b"}, change.Removed)
+}
+
+func TestStreamProvider_FallsBackToPolling(t *testing.T) {
+	var polls int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/flags", func(w http.ResponseWriter, r *http.Request) {
+		variant := "no"
+		if atomic.AddInt32(&polls, 1) > 1 {
+			variant = "yes"
+		}
+		_, _ = w.Write([]byte(`{ "a": ` + boolFlagJSON(variant) + ` }`))
+	})
+	server := httptest.NewServer(mux) // no /stream, so it is not found
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := NewDynamicStore(ctx, NewStreamProvider(server.URL+"/stream", server.URL+"/flags", "", 20*time.Millisecond))
+	require.NoError(t, store.Start())
+	defer store.Close()
+	changes := make(chan ChangeEvent, 10)
+	store.Subscribe(func(evt ChangeEvent) { changes <- evt })
+
+	assert.Equal(t, []string{"a"}, receive(t, changes).Modified)
+	f, _ := store.Get("a")
+	assert.Equal(t, "yes", f.DefaultVariant)
+}
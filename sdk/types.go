@@ -0,0 +1,144 @@
+package sdk
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// FlagType optionally declares the type that every variant of a Flag must have
+type FlagType string
+
+const (
+	TypeBoolean FlagType = "boolean"
+	TypeString  FlagType = "string"
+	TypeInteger FlagType = "integer"
+	TypeFloat   FlagType = "float"
+	TypeObject  FlagType = "object"
+)
+
+// FlagTypes lists every supported FlagType
+var FlagTypes = []FlagType{TypeBoolean, TypeString, TypeInteger, TypeFloat, TypeObject}
+
+// Valid reports whether t is one of the supported flag types
+func (t FlagType) Valid() bool {
+	for _, known := range FlagTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether a variant value is of this type.
+// Integers may be decoded as whole floats (as JSON does), and floats accept any number.
+func (t FlagType) Matches(value interface{}) bool {
+	switch t {
+	case TypeBoolean:
+		_, ok := value.(bool)
+		return ok
+	case TypeString:
+		_, ok := value.(string)
+		return ok
+	case TypeInteger:
+		switch v := value.(type) {
+		case int, int32, int64, uint, uint32, uint64:
+			return true
+		case float64:
+			return v == math.Trunc(v)
+		}
+		return false
+	case TypeFloat:
+		_, ok := toFloat(value)
+		return ok
+	case TypeObject:
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// checkVariants verifies every variant of the flag against its declared type and schema.
+// Flags without a type or schema are not checked.
+func (f Flag) checkVariants() []error {
+	if f.Type != "" && !f.Type.Valid() {
+		return []error{fmt.Errorf("unknown type %q", f.Type)}
+	}
+
+	var errs []error
+	for _, name := range sortedVariantNames(f) {
+		for _, problem := range f.checkVariant(name) {
+			errs = append(errs, fmt.Errorf("variant %q: %s", name, problem))
+		}
+	}
+	return errs
+}
+
+// checkVariant describes every way in which the named variant breaks the flag's type or schema
+func (f Flag) checkVariant(name string) []string {
+	value := f.Variants[name]
+	if f.Type != "" && !f.Type.Matches(value) {
+		return []string{fmt.Sprintf("expected %s, got %s", f.Type, describeType(value))}
+	}
+	if f.Schema != nil {
+		return validateSchema(f.Schema, f.Schema, value, "")
+	}
+	return nil
+}
+
+func sortedVariantNames(f Flag) []string {
+	names := make([]string, 0, len(f.Variants))
+	for name := range f.Variants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func describeType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		if f, ok := toFloat(v); ok {
+			if f == math.Trunc(f) {
+				return "integer"
+			}
+			return "float"
+		}
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
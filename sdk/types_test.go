@@ -0,0 +1,129 @@
+package sdk
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlagType_Matches(t *testing.T) {
+	tests := []struct {
+		flagType FlagType
+		value    interface{}
+		expected bool
+	}{
+		{TypeBoolean, true, true},
+		{TypeBoolean, "true", false},
+		{TypeString, "on", true},
+		{TypeString, 3, false},
+		{TypeInteger, 3, true},
+		{TypeInteger, float64(3), true},
+		{TypeInteger, 3.5, false},
+		{TypeFloat, 3.5, true},
+		{TypeFloat, 3, true},
+		{TypeFloat, "3.5", false},
+		{TypeObject, map[string]interface{}{"a": 1}, true},
+		{TypeObject, []interface{}{1, 2}, true},
+		{TypeObject, "{}", false},
+		{FlagType("unknown"), true, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, tt.flagType.Matches(tt.value), "%s %#v", tt.flagType, tt.value)
+	}
+}
+
+func TestLoad_ReportsMismatchedVariantTypes(t *testing.T) {
+	data := []byte(`{
+		"mixed": {
+			"type": "boolean",
+			"defaultVariant": "on",
+			"variants": { "on": true, "text": "on", "number": 3 }
+		}
+	}`)
+	store, err := NewStoreFromBytesWithFormat(data, "json")
+	require.NoError(t, err)
+	errs := store.Diagnostics().Errors()
+	require.Len(t, errs, 2)
+	assert.Equal(t, "variants.number", errs[0].Path)
+	assert.Equal(t, "expected boolean, got integer", errs[0].Message)
+	assert.Equal(t, "variants.text", errs[1].Path)
+	assert.Equal(t, "expected boolean, got string", errs[1].Message)
+
+	_, err = NewStoreFromBytesWithFormat(data, "json", WithStrictValidation())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `mixed.variants.number: expected boolean, got integer`)
+	assert.Contains(t, err.Error(), `mixed.variants.text: expected boolean, got string`)
+}
+
+func TestLoad_ReportsUnknownType(t *testing.T) {
+	_, err := NewStoreFromBytesWithFormat([]byte(`
+limit:
+  type: decimal
+  defaultVariant: low
+  variants:
+    low: 1
+`), "yaml", WithStrictValidation())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `limit.type: unknown type "decimal"`)
+}
+
+func TestLoad_AcceptsMatchingTypes(t *testing.T) {
+	store, err := NewStoreFromBytesWithFormat([]byte(`
+limit:
+  type: integer
+  defaultVariant: low
+  variants:
+    low: 5
+    high: 10
+ratio:
+  type: float
+  defaultVariant: half
+  variants:
+    half: 0.5
+    one: 1
+`), "yaml")
+	require.NoError(t, err)
+	flag, ok := store.Get("limit")
+	require.True(t, ok)
+	assert.Equal(t, TypeInteger, flag.Type)
+}
+
+func TestLoad_ValidatesObjectVariantsAgainstSchema(t *testing.T) {
+	flags := func(retry string) []byte {
+		return []byte(`{
+			"checkout": {
+				"type": "object",
+				"defaultVariant": "standard",
+				"schema": {
+					"type": "object",
+					"required": ["timeout"],
+					"properties": {
+						"timeout": { "type": "integer", "minimum": 1 },
+						"retry": { "type": "boolean" }
+					},
+					"additionalProperties": false
+				},
+				"variants": {
+					"standard": { "timeout": 30, "retry": false },
+					"beta": ` + retry + `
+				}
+			}
+		}`)
+	}
+
+	_, err := NewStoreFromBytesWithFormat(flags(`{ "timeout": 10, "retry": true }`), "json", WithStrictValidation())
+	assert.NoError(t, err)
+
+	_, err = NewStoreFromBytesWithFormat(flags(`{ "timeout": 0, "retry": "yes", "extra": 1 }`), "json", WithStrictValidation())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `checkout.variants.beta: timeout: must be >= 1`)
+	assert.Contains(t, err.Error(), `checkout.variants.beta: retry: expected boolean, got string`)
+	assert.Contains(t, err.Error(), `checkout.variants.beta: (root): property "extra" is not allowed`)
+
+	store, err := NewStoreFromBytesWithFormat(flags(`{ "retry": true }`), "json")
+	require.NoError(t, err, "only rejected with WithStrictValidation")
+	err = store.Diagnostics().Err()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `missing required property "timeout"`)
+}
@@ -0,0 +1,340 @@
+package sdk
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Severity says whether a Diagnostic makes a flag file invalid, or is just a warning
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic describes a single problem found while validating flags
+type Diagnostic struct {
+	Severity  Severity `json:"severity"`
+	File      string   `json:"file,omitempty"` // set when flags are merged from several files
+	FlagKey   string   `json:"flag,omitempty"`
+	RuleIndex int      `json:"rule"`           // -1 when the problem is not about a rule
+	Path      string   `json:"path,omitempty"` // field path within the flag, e.g. "rules[0].variant"
+	Line      int      `json:"line,omitempty"` // source line, 0 when unknown
+	Code      string   `json:"code,omitempty"` // identifies the kind of problem, for those which callers act on
+	Message   string   `json:"message"`
+}
+
+// CodeUnknownField is the Code of a diagnostic about a field which is not part of the format,
+// and so is dropped when the flags are decoded
+const CodeUnknownField = "unknown-field"
+
+func (d Diagnostic) String() string {
+	var sb strings.Builder
+	if d.File != "" {
+		sb.WriteString(d.File + ": ")
+	}
+	if d.Line > 0 {
+		sb.WriteString("line " + strconv.Itoa(d.Line) + ": ")
+	}
+	sb.WriteString(string(d.Severity) + ": ")
+	if location := joinPath(d.FlagKey, d.Path); location != "" {
+		sb.WriteString(location + ": ")
+	}
+	sb.WriteString(d.Message)
+	return sb.String()
+}
+
+// Diagnostics is the result of a validation pass, ordered by flag key and then by path
+type Diagnostics []Diagnostic
+
+// Errors returns only the diagnostics which make the flags invalid
+func (d Diagnostics) Errors() Diagnostics {
+	return d.filter(SeverityError)
+}
+
+// Warnings returns only the diagnostics which do not make the flags invalid
+func (d Diagnostics) Warnings() Diagnostics {
+	return d.filter(SeverityWarning)
+}
+
+// HasErrors reports whether any diagnostic is an error
+func (d Diagnostics) HasErrors() bool {
+	return len(d.Errors()) > 0
+}
+
+// Err returns a *ValidationError holding the errors, or nil when there are none
+func (d Diagnostics) Err() error {
+	errs := d.Errors()
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Diagnostics: errs}
+}
+
+func (d Diagnostics) filter(severity Severity) Diagnostics {
+	var result Diagnostics
+	for _, diag := range d {
+		if diag.Severity == severity {
+			result = append(result, diag)
+		}
+	}
+	return result
+}
+
+// ValidationError is returned when flags are rejected because they failed validation
+type ValidationError struct {
+	Diagnostics Diagnostics
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Diagnostics))
+	for _, d := range e.Diagnostics {
+		lines = append(lines, d.String())
+	}
+	return "invalid flags: " + strings.Join(lines, "; ")
+}
+
+// Validate parses a flag file and checks it for problems which would only otherwise show up at
+// evaluation time (or never). The returned error is only for files which cannot be parsed at all.
+// Unknown fields are reported as warnings, or as errors when WithStrictDecoding is given.
+func Validate(data []byte, format string, opts ...Option) (Diagnostics, error) {
+	doc, err := ParseDocument(data, format)
+	if err != nil {
+		return nil, err
+	}
+	diags, unknown := doc.validate(newOptions(opts))
+	return mergeDiagnostics(diags, unknown), nil
+}
+
+// validate checks the flags of the document, and when the source is known, locates each problem
+// and looks for unknown fields. Unknown fields are returned separately so they can be rejected alone.
+func (d *Document) validate(o options) (diags Diagnostics, unknown Diagnostics) {
+	diags = validateFlags(d.Flags, d.Segments)
+	for _, key := range sortedKeys(d.legacy) {
+		diags = append(diags, Diagnostic{
+			Severity:  SeverityWarning,
+			FlagKey:   key,
+			RuleIndex: -1,
+			Message:   "flag uses the deprecated v1 format, run `ducto-flags migrate` to upgrade the file",
+		})
+	}
+	diags = mergeDiagnostics(diags, nil)
+
+	root := sourceNode(d.source)
+	if root == nil {
+		return diags, nil
+	}
+	flagsRoot := root
+	if d.envelope {
+		flagsRoot, _ = childNode(root, "flags")
+	}
+	for i := range diags {
+		if diags[i].FlagKey == "" {
+			diags[i].Line = findLine(root, "", diags[i].Path)
+		} else if flagsRoot != nil {
+			diags[i].Line = findLine(flagsRoot, diags[i].FlagKey, diags[i].Path)
+		}
+	}
+	return diags, d.unknownFields(root, flagsRoot, o.unknownFieldSeverity())
+}
+
+// mergeDiagnostics combines two sets of diagnostics, keeping them grouped by flag key
+func mergeDiagnostics(a, b Diagnostics) Diagnostics {
+	merged := append(append(Diagnostics{}, a...), b...)
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].FlagKey < merged[j].FlagKey
+	})
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
+
+// ValidateFlags checks already parsed flags for problems. Source lines are not available.
+func ValidateFlags(flags map[string]Flag) Diagnostics {
+	return validateFlags(flags, nil)
+}
+
+func validateFlags(flags map[string]Flag, segments map[string]Segment) Diagnostics {
+	var diags Diagnostics
+	for _, key := range sortedKeys(flags) {
+		diags = append(diags, validateFlag(key, flags[key], segments)...)
+	}
+	return diags
+}
+
+func validateFlag(key string, f Flag, segments map[string]Segment) Diagnostics {
+	var diags Diagnostics
+	report := func(severity Severity, rule int, path, format string, args ...interface{}) {
+		diags = append(diags, Diagnostic{
+			Severity:  severity,
+			FlagKey:   key,
+			RuleIndex: rule,
+			Path:      path,
+			Message:   fmt.Sprintf(format, args...),
+		})
+	}
+
+	if len(f.Variants) == 0 {
+		report(SeverityError, -1, "variants", "flag has no variants")
+	}
+	if f.DefaultVariant == "" {
+		report(SeverityError, -1, "defaultVariant", "defaultVariant is required")
+	} else if _, ok := f.Variants[f.DefaultVariant]; !ok {
+		report(SeverityError, -1, "defaultVariant", "variant %q is not defined", f.DefaultVariant)
+	}
+
+	if f.Type != "" && !f.Type.Valid() {
+		report(SeverityError, -1, "type", "unknown type %q", f.Type)
+	} else {
+		for _, name := range sortedVariantNames(f) {
+			for _, problem := range f.checkVariant(name) {
+				report(SeverityError, -1, "variants."+name, "%s", problem)
+			}
+		}
+	}
+
+	validateRules(f, f.Rules, segments, "", report)
+
+	envs := make([]string, 0, len(f.Environments))
+	for env := range f.Environments {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+	for _, env := range envs {
+		override := f.Environments[env]
+		prefix := "environments." + env
+		if override.DefaultVariant != "" {
+			if _, ok := f.Variants[override.DefaultVariant]; !ok {
+				report(SeverityError, -1, prefix+".defaultVariant", "variant %q is not defined", override.DefaultVariant)
+			}
+		}
+		validateRules(f, override.Rules, segments, prefix+".", report)
+	}
+
+	if f.ExpiresAt != nil && f.Expired(time.Now()) {
+		report(SeverityWarning, -1, "expiresAt", "flag expired on %s", f.ExpiresAt.Format(time.RFC3339))
+	}
+	return diags
+}
+
+func validateRules(f Flag, rules []VariantRule, segments map[string]Segment, prefix string, report func(Severity, int, string, string, ...interface{})) {
+	catchAll := -1
+	for i, rule := range rules {
+		path := fmt.Sprintf("%srules[%d]", prefix, i)
+		if catchAll >= 0 {
+			report(SeverityWarning, i, path, "rule is unreachable as rule %d always matches", catchAll)
+		}
+
+		if rule.Variant == "" {
+			report(SeverityError, i, path+".variant", "variant is required")
+		} else if _, ok := f.Variants[rule.Variant]; !ok {
+			report(SeverityError, i, path+".variant", "variant %q is not defined", rule.Variant)
+		}
+
+		if rule.Percent != nil {
+			switch p := *rule.Percent; {
+			case p < 0 || p > 100:
+				report(SeverityError, i, path+".percent", "percent must be between 0 and 100, got %d", p)
+			case p == 0:
+				report(SeverityWarning, i, path+".percent", "a percent of 0 never matches")
+			}
+			if rule.Seed == "" {
+				report(SeverityError, i, path+".seed", "seed is required when percent is set")
+			}
+		} else if rule.Seed != "" || rule.SeedHash != "" {
+			report(SeverityWarning, i, path+".seed", "seed is ignored without percent")
+		}
+
+		switch rule.SeedHash {
+		case "", "sha256", "fnv":
+		default:
+			report(SeverityError, i, path+".seed_hash", "unknown seed_hash %q (expected \"sha256\" or \"fnv\")", rule.SeedHash)
+		}
+
+		if rule.Segment != "" {
+			if segment, ok := segments[rule.Segment]; !ok {
+				report(SeverityError, i, path+".segment", "segment %q is not defined", rule.Segment)
+			} else if conflicts := segmentConflicts(rule, segment); len(conflicts) > 0 {
+				report(SeverityError, i, path+".if", "conditions on %s contradict segment %q, so the rule never matches",
+					strings.Join(conflicts, ", "), rule.Segment)
+			}
+		}
+
+		if catchAll < 0 && len(rule.If) == 0 && rule.Percent == nil && rule.Segment == "" {
+			catchAll = i
+		}
+	}
+}
+
+// sourceNode parses the source document for locating diagnostics, returning its root node.
+// JSON is a subset of YAML, so the YAML parser is used for both formats.
+func sourceNode(data []byte) *yaml.Node {
+	var doc yaml.Node
+	if data == nil || yaml.Unmarshal(data, &doc) != nil || len(doc.Content) == 0 {
+		return nil
+	}
+	return doc.Content[0]
+}
+
+// findLine returns the line of the deepest node along the path which exists in the document
+func findLine(root *yaml.Node, key, path string) int {
+	var segments []string
+	if key != "" {
+		segments = append(segments, key)
+	}
+	if path != "" {
+		segments = append(segments, splitPath(path)...)
+	}
+
+	node, line := root, 0
+	for _, segment := range segments {
+		next, keyNode := childNode(node, segment)
+		if next == nil {
+			break
+		}
+		node, line = next, next.Line
+		if keyNode != nil {
+			line = keyNode.Line
+		}
+	}
+	return line
+}
+
+func childNode(node *yaml.Node, segment string) (value *yaml.Node, key *yaml.Node) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == segment {
+				return node.Content[i+1], node.Content[i]
+			}
+		}
+	case yaml.SequenceNode:
+		if i, err := strconv.Atoi(segment); err == nil && i >= 0 && i < len(node.Content) {
+			return node.Content[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// splitPath turns "rules[0].variant" into ["rules", "0", "variant"]
+func splitPath(path string) []string {
+	path = strings.ReplaceAll(path, "[", ".")
+	path = strings.ReplaceAll(path, "]", "")
+	return strings.Split(path, ".")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
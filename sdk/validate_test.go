@@ -0,0 +1,114 @@
+package sdk
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const invalidFlagsYAML = `new_ui:
+  variants:
+    on: true
+    off: false
+  defaultVariant: maybe
+  rules:
+    - if:
+        env: prod
+      variant: missing
+    - percent: 150
+      variant: on
+      seed_hash: md5
+    - variant: on
+    - if:
+        env: dev
+      variant: off
+  environments:
+    dev:
+      defaultVariant: nope
+old_flag:
+  variants:
+    on: true
+  defaultVariant: on
+  expiresAt: 2020-01-01T00:00:00Z
+`
+
+func TestValidate_ReportsProblems(t *testing.T) {
+	diags, err := Validate([]byte(invalidFlagsYAML), "yaml")
+	require.NoError(t, err)
+
+	var got []string
+	for _, d := range diags {
+		got = append(got, d.String())
+	}
+	assert.Equal(t, []string{
+		`line 5: error: new_ui.defaultVariant: variant "maybe" is not defined`,
+		`line 9: error: new_ui.rules[0].variant: variant "missing" is not defined`,
+		`line 10: error: new_ui.rules[1].percent: percent must be between 0 and 100, got 150`,
+		`line 10: error: new_ui.rules[1].seed: seed is required when percent is set`,
+		`line 12: error: new_ui.rules[1].seed_hash: unknown seed_hash "md5" (expected "sha256" or "fnv")`,
+		`line 14: warning: new_ui.rules[3]: rule is unreachable as rule 2 always matches`,
+		`line 19: error: new_ui.environments.dev.defaultVariant: variant "nope" is not defined`,
+		`line 24: warning: old_flag.expiresAt: flag expired on 2020-01-01T00:00:00Z`,
+	}, got)
+
+	assert.True(t, diags.HasErrors())
+	assert.Len(t, diags.Warnings(), 2)
+	assert.Equal(t, 1, diags[2].RuleIndex)
+	assert.Equal(t, -1, diags[0].RuleIndex)
+}
+
+func TestValidate_JSONLines(t *testing.T) {
+	diags, err := Validate([]byte(`{
+	"a": {
+		"variants": { "on": true },
+		"defaultVariant": "on",
+		"rules": [
+			{ "variant": "off" }
+		]
+	}
+}`), "json")
+	require.NoError(t, err)
+	require.Len(t, diags, 1)
+	assert.Equal(t, "a", diags[0].FlagKey)
+	assert.Equal(t, 0, diags[0].RuleIndex)
+	assert.Equal(t, "rules[0].variant", diags[0].Path)
+	assert.Equal(t, 6, diags[0].Line)
+}
+
+func TestValidate_ParseError(t *testing.T) {
+	_, err := Validate([]byte(`{ broken`), "json")
+	assert.Error(t, err)
+}
+
+func TestValidateFlags_MissingVariants(t *testing.T) {
+	diags := ValidateFlags(map[string]Flag{"empty": {}})
+	require.Len(t, diags, 2)
+	assert.Equal(t, "variants", diags[0].Path)
+	assert.Equal(t, "defaultVariant", diags[1].Path)
+	assert.Equal(t, 0, diags[0].Line)
+}
+
+func TestValidate_ExamplesAreClean(t *testing.T) {
+	for _, name := range []string{"01-simplest.json", "02-percent.yaml", "03-percent_hashed.json", "04-with_rules.yaml", "05-environments.yaml"} {
+		store, err := NewStoreFromFile("../examples/"+name, WithStrictValidation())
+		require.NoError(t, err, name)
+		assert.Empty(t, store.Diagnostics(), name)
+	}
+}
+
+func TestStrictValidation(t *testing.T) {
+	// Lenient by default, problems are only reported
+	store, err := NewStoreFromBytesWithFormat([]byte(invalidFlagsYAML), "yaml")
+	require.NoError(t, err)
+	assert.True(t, store.Diagnostics().HasErrors())
+
+	_, err = NewStoreFromBytesWithFormat([]byte(invalidFlagsYAML), "yaml", WithStrictValidation())
+	require.Error(t, err)
+
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.Len(t, validationErr.Diagnostics, 6)
+	assert.Contains(t, err.Error(), `line 5: error: new_ui.defaultVariant: variant "maybe" is not defined`)
+}